@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type dedupKey struct {
+	ip, message string
+}
+
+type dedupState struct {
+	first    *LogRecord
+	lastSeen time.Time
+	repeats  int
+}
+
+// Сгъва повтарящите се съобщения от един и същ IP адрес в стила на syslog:
+// първото срещане се пропуска нататък, а след него идва ред
+// "last message repeated N times" с времето на последното повторение.
+// При Window == 0 се сгъват само последователни повторения,
+// иначе - всички повторения до Window след първото срещане (или преди
+// него, ако записите идват от най-новия към най-стария, както при -reverse).
+type Deduplicator struct {
+	Window time.Duration
+	states map[dedupKey]*dedupState
+	order  []dedupKey
+}
+
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		Window: window,
+		states: make(map[dedupKey]*dedupState),
+	}
+}
+
+func (d *Deduplicator) Push(record *LogRecord, emit func(*LogRecord)) {
+	key := dedupKey{record.IP, record.Message}
+
+	if d.Window > 0 {
+		d.expire(record.Time, emit)
+	} else if _, isRepeat := d.states[key]; !isRepeat {
+		d.Flush(emit)
+	}
+
+	if state, isRepeat := d.states[key]; isRepeat {
+		state.repeats++
+		state.lastSeen = record.Time
+		return
+	}
+
+	emit(record)
+	d.states[key] = &dedupState{first: record, lastSeen: record.Time}
+	d.order = append(d.order, key)
+}
+
+// Извежда обобщенията за всички незатворени серии от повторения.
+func (d *Deduplicator) Flush(emit func(*LogRecord)) {
+	for _, key := range d.order {
+		d.summarize(d.states[key], emit)
+		delete(d.states, key)
+	}
+
+	d.order = d.order[:0]
+}
+
+func (d *Deduplicator) expire(now time.Time, emit func(*LogRecord)) {
+	for len(d.order) > 0 {
+		key := d.order[0]
+		state := d.states[key]
+
+		elapsed := now.Sub(state.first.Time)
+
+		if elapsed < 0 {
+			elapsed = -elapsed
+		}
+
+		if elapsed <= d.Window {
+			return
+		}
+
+		d.summarize(state, emit)
+		delete(d.states, key)
+		d.order = d.order[1:]
+	}
+}
+
+func (d *Deduplicator) summarize(state *dedupState, emit func(*LogRecord)) {
+	if state.repeats == 0 {
+		return
+	}
+
+	emit(&LogRecord{
+		Time:    state.lastSeen,
+		IP:      state.first.IP,
+		Message: fmt.Sprintf("last message repeated %d times", state.repeats),
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+const testNoisyLogContents = `2015-08-23 12:37:03 10.0.0.1 connection refused
+2015-08-23 12:37:04 10.0.0.1 connection refused
+2015-08-23 12:37:05 10.0.0.2 connection refused
+2015-08-23 12:37:06 10.0.0.1 connection refused
+2015-08-23 12:37:07 10.0.0.1 connection refused
+2015-08-23 12:37:08 10.0.0.1 connection refused
+2015-08-23 12:39:00 10.0.0.1 connection refused
+`
+
+func TestDedupConsecutive(t *testing.T) {
+	expected := `2015-08-23 12:37:03 10.0.0.1 connection refused
+2015-08-23 12:37:04 10.0.0.1 last message repeated 1 times
+2015-08-23 12:37:05 10.0.0.2 connection refused
+2015-08-23 12:37:06 10.0.0.1 connection refused
+2015-08-23 12:39:00 10.0.0.1 last message repeated 3 times
+`
+
+	testRun(t, expected, testNoisyLogContents, "-dedup")
+}
+
+func TestDedupWindow(t *testing.T) {
+	expected := `2015-08-23 12:37:03 10.0.0.1 connection refused
+2015-08-23 12:37:05 10.0.0.2 connection refused
+2015-08-23 12:37:08 10.0.0.1 last message repeated 4 times
+2015-08-23 12:39:00 10.0.0.1 connection refused
+`
+
+	testRun(t, expected, testNoisyLogContents, "-dedup-window", "1m")
+}
+
+func TestDedupWindowReverse(t *testing.T) {
+	expected := `2015-08-23 12:39:00 10.0.0.1 connection refused
+2015-08-23 12:37:08 10.0.0.1 connection refused
+2015-08-23 12:37:05 10.0.0.2 connection refused
+2015-08-23 12:37:03 10.0.0.1 last message repeated 4 times
+`
+
+	testRun(t, expected, testNoisyLogContents, "-dedup-window", "1m", "-reverse", "-")
+}
+
+func TestDedupKeepsDistinctMessages(t *testing.T) {
+	testRun(t, testLogContents, testLogContents, "-dedup")
+}
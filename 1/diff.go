@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var templatePlaceholders = []struct {
+	pattern     *regexp.Regexp
+	isMatch     func(match string) bool
+	placeholder string
+}{
+	{regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), nil, "<uuid>"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), nil, "<ip>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{6,}\b`), isHexIdentifier, "<hex>"},
+	{regexp.MustCompile(`\b\d+(?:\.\d+)?`), nil, "<num>"},
+}
+
+// Идентификатори като "3fa9c0d1", но не и думи като "decade" или числа.
+func isHexIdentifier(match string) bool {
+	return strings.HasPrefix(match, "0x") ||
+		strings.ContainsAny(match, "0123456789") && strings.ContainsAny(match, "abcdefABCDEF")
+}
+
+// Шаблонът на съобщение е съобщението с числа, адреси и идентификатори,
+// заменени с контейнери, така че "user 12 logged in" и "user 7 logged in"
+// да се броят заедно.
+func MessageTemplate(message string) string {
+	for _, placeholder := range templatePlaceholders {
+		message = placeholder.pattern.ReplaceAllStringFunc(message, func(match string) string {
+			if placeholder.isMatch != nil && !placeholder.isMatch(match) {
+				return match
+			}
+
+			return placeholder.placeholder
+		})
+	}
+
+	return message
+}
+
+type LogSummary struct {
+	Total     int
+	Templates map[string]int
+	IPs       map[string]int
+}
+
+func SummarizeLog(inputs []*Input, stdin io.Reader, filter *Filter) (*LogSummary, error) {
+	summary := &LogSummary{
+		Templates: make(map[string]int),
+		IPs:       make(map[string]int),
+	}
+
+	err := ForEachRecord(inputs, stdin, func(record *LogRecord) error {
+		if filter == nil || filter.Match(record) {
+			summary.Total++
+			summary.Templates[MessageTemplate(record.Message)]++
+			summary.IPs[record.IP]++
+		}
+
+		return nil
+	})
+
+	return summary, err
+}
+
+type DiffEntry struct {
+	Key                string
+	OldCount, NewCount int
+	OldRate, NewRate   float64
+}
+
+type CountDiff struct {
+	New, Vanished, Changed []*DiffEntry
+}
+
+// Сравнява броячите на два лога. Понеже логовете може да са с различна
+// дължина, промяната се мери по дял от всички записи: значима е, ако
+// делът се е променил поне threshold пъти в някоя посока.
+// Ключове с по-малко от minCount срещания и в двата лога се пренебрегват.
+func DiffCounts(oldCounts, newCounts map[string]int, oldTotal, newTotal int, threshold float64, minCount int) *CountDiff {
+	diff := &CountDiff{}
+	keys := make(map[string]bool)
+
+	for key := range oldCounts {
+		keys[key] = true
+	}
+
+	for key := range newCounts {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		entry := &DiffEntry{
+			Key:      key,
+			OldCount: oldCounts[key],
+			NewCount: newCounts[key],
+			OldRate:  rate(oldCounts[key], oldTotal),
+			NewRate:  rate(newCounts[key], newTotal),
+		}
+
+		if entry.OldCount < minCount && entry.NewCount < minCount {
+			continue
+		}
+
+		switch {
+		case entry.OldCount == 0:
+			diff.New = append(diff.New, entry)
+		case entry.NewCount == 0:
+			diff.Vanished = append(diff.Vanished, entry)
+		case entry.ratio() >= threshold:
+			diff.Changed = append(diff.Changed, entry)
+		}
+	}
+
+	for _, entries := range [][]*DiffEntry{diff.New, diff.Vanished, diff.Changed} {
+		sort.Slice(entries, func(i, j int) bool {
+			if a, b := entries[i].magnitude(), entries[j].magnitude(); a != b {
+				return a > b
+			}
+
+			return entries[i].Key < entries[j].Key
+		})
+	}
+
+	return diff
+}
+
+func rate(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(count) / float64(total)
+}
+
+func (e *DiffEntry) ratio() float64 {
+	return math.Max(e.NewRate/e.OldRate, e.OldRate/e.NewRate)
+}
+
+func (e *DiffEntry) magnitude() int {
+	if e.NewCount > e.OldCount {
+		return e.NewCount - e.OldCount
+	}
+
+	return e.OldCount - e.NewCount
+}
+
+func (d *CountDiff) Write(writer io.Writer, title string) {
+	fmt.Fprintf(writer, "%s: %d new, %d vanished, %d changed\n", title, len(d.New), len(d.Vanished), len(d.Changed))
+
+	for _, section := range []struct {
+		mark    string
+		entries []*DiffEntry
+	}{{"+", d.New}, {"-", d.Vanished}, {"~", d.Changed}} {
+		for _, entry := range section.entries {
+			fmt.Fprintf(writer, "%s %d -> %d (%.2f%% -> %.2f%%)\t%s\n",
+				section.mark, entry.OldCount, entry.NewCount, 100*entry.OldRate, 100*entry.NewRate, entry.Key)
+		}
+	}
+}
+
+func runDiff(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("extract-column diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	inputFlags := addInputFlags(flags)
+	filterFlags := addFilterFlags(flags)
+	threshold := flags.Float64("threshold", 2, "minimum factor by which a rate must change to be reported")
+	minCount := flags.Int("min-count", 1, "ignore templates and IPs seen fewer times than this in both logs")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 2 {
+		return fmt.Errorf("diff needs exactly two logs, found %d", flags.NArg())
+	}
+
+	inputs, err := inputFlags.inputs(flags.Args())
+
+	if err != nil {
+		return err
+	}
+
+	filter, err := filterFlags.filter()
+
+	if err != nil {
+		return err
+	}
+
+	oldSummary, err := SummarizeLog(inputs[:1], stdin, filter)
+
+	if err != nil {
+		return err
+	}
+
+	newSummary, err := SummarizeLog(inputs[1:], stdin, filter)
+
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(stdout)
+	fmt.Fprintf(writer, "records: %d -> %d\n", oldSummary.Total, newSummary.Total)
+	DiffCounts(oldSummary.Templates, newSummary.Templates, oldSummary.Total, newSummary.Total, *threshold, *minCount).Write(writer, "templates")
+	DiffCounts(oldSummary.IPs, newSummary.IPs, oldSummary.Total, newSummary.Total, *threshold, *minCount).Write(writer, "ips")
+	return writer.Flush()
+}
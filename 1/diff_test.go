@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMessageTemplate(t *testing.T) {
+	for message, expected := range map[string]string{
+		"user 12 logged in from 10.0.0.1":                           "user <num> logged in from <ip>",
+		"request 3fa9c0d1 took 0.25s":                               "request <hex> took <num>s",
+		"request 3fa9c0d1 took 0.25 s":                              "request <hex> took <num> s",
+		"job 123e4567-e89b-12d3-a456-426614174000 failed at 0xdead": "job <uuid> failed at <hex>",
+		"a decade of DNS":                                           "a decade of DNS",
+	} {
+		if found := MessageTemplate(message); found != expected {
+			t.Errorf("Expected %q for %q but found %q", expected, message, found)
+		}
+	}
+}
+
+func TestDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	yesterday := filepath.Join(dir, "yesterday.log")
+	today := filepath.Join(dir, "today.log")
+
+	writeTestFile(t, yesterday, `2015-08-22 10:00:00 10.0.0.1 user 1 logged in
+2015-08-22 10:00:01 10.0.0.1 user 2 logged in
+2015-08-22 10:00:02 10.0.0.2 cache miss for key 17
+2015-08-22 10:00:03 10.0.0.2 user 3 logged in
+`)
+	writeTestFile(t, today, `2015-08-23 10:00:00 10.0.0.1 user 4 logged in
+2015-08-23 10:00:01 10.0.0.3 disk 2 is full
+2015-08-23 10:00:02 10.0.0.3 disk 2 is full
+2015-08-23 10:00:03 10.0.0.3 disk 3 is full
+2015-08-23 10:00:04 10.0.0.1 user 5 logged in
+2015-08-23 10:00:05 10.0.0.1 user 6 logged in
+2015-08-23 10:00:06 10.0.0.1 user 7 logged in
+2015-08-23 10:00:07 10.0.0.1 user 8 logged in
+`)
+
+	expected := `records: 4 -> 8
+templates: 1 new, 1 vanished, 0 changed
++ 0 -> 3 (0.00% -> 37.50%)	disk <num> is full
+- 1 -> 0 (25.00% -> 0.00%)	cache miss for key <num>
+ips: 1 new, 1 vanished, 0 changed
++ 0 -> 3 (0.00% -> 37.50%)	10.0.0.3
+- 2 -> 0 (50.00% -> 0.00%)	10.0.0.2
+`
+
+	testRun(t, expected, "", "diff", yesterday, today)
+}
+
+func TestDiffCountsReportsChangedRates(t *testing.T) {
+	diff := DiffCounts(map[string]int{"a": 10, "b": 10}, map[string]int{"a": 40, "b": 12}, 100, 100, 2, 1)
+
+	if len(diff.Changed) != 1 || diff.Changed[0].Key != "a" {
+		t.Errorf("Expected only a to have changed significantly but found %v", diff.Changed)
+	}
+
+	diff = DiffCounts(map[string]int{"rare": 1}, map[string]int{"noise": 2}, 100, 100, 2, 3)
+
+	if len(diff.New)+len(diff.Vanished)+len(diff.Changed) != 0 {
+		t.Errorf("Expected keys below min-count to be ignored but found %+v", diff)
+	}
+}
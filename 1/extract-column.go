@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -43,7 +44,36 @@ func ExtractColumn(logContents string, column uint8) string {
 	return buffer.String()
 }
 
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+var commands = map[string]command{
+	"split":   runSplit,
+	"profile": runProfile,
+	"serve":   runServe,
+	"diff":    runDiff,
+	"metrics": runMetrics,
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) > 0 {
+		if command, isCommand := commands[args[0]]; isCommand {
+			return command(args[1:], stdin, stdout, stderr)
+		}
+	}
+
+	return runExtract(args, stdin, stdout, stderr)
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintln(os.Stderr, "extract-column:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	var (
 		column uint8
 		buffer bytes.Buffer
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+)
+
+type Input struct {
+	Path     string
+	Location *time.Location
+}
+
+type OutputOptions struct {
+	Fields     []string
+	Location   *time.Location
+	TimeFormat string
+}
+
+// Входът се задава като път, по желание последван от зоната на източника:
+// "server1.log@Europe/Sofia". Пътят "-" означава стандартния вход. Път,
+// който съдържа "@" (например "logs/user@host.log"), се чете със зоната
+// по подразбиране, ако частта след "@" не е зона, а файлът съществува.
+func ParseInput(spec string, defaultLocation *time.Location) (*Input, error) {
+	input := &Input{Path: spec, Location: defaultLocation}
+
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		location, err := LoadLocation(spec[i+1:])
+
+		if err != nil {
+			if _, statErr := os.Stat(spec); statErr == nil {
+				return input, nil
+			}
+
+			return nil, err
+		}
+
+		input.Path = spec[:i]
+		input.Location = location
+	}
+
+	return input, nil
+}
+
+func (in *Input) Open(stdin io.Reader) (io.ReadCloser, error) {
+	if in.Path == "-" {
+		return io.NopCloser(stdin), nil
+	}
+
+	return os.Open(in.Path)
+}
+
+func (in *Input) Scan(stdin io.Reader, handle func(*LogRecord) error) error {
+	reader, err := in.Open(stdin)
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	if err = ScanLogRecords(reader, in.Location, handle); err != nil {
+		return fmt.Errorf("%s: %w", in.Path, err)
+	}
+
+	return nil
+}
+
+// Прочита всички входове и слива записите им по време (виж ForEachRecord),
+// така че логове от сървъри в различни зони да се подредят правилно.
+func ReadRecords(inputs []*Input, stdin io.Reader) ([]*LogRecord, error) {
+	var records []*LogRecord
+
+	err := ForEachRecord(inputs, stdin, func(record *LogRecord) error {
+		records = append(records, record)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Обхожда записите на входовете поточно. Записите на няколко входа се
+// сливат по време, като се очаква всеки вход да е подреден хронологично;
+// при равно време първи са записите на по-ранния вход.
+func ForEachRecord(inputs []*Input, stdin io.Reader, handle func(*LogRecord) error) error {
+	if len(inputs) == 1 {
+		return inputs[0].Scan(stdin, handle)
+	}
+
+	var sources mergeHeap
+
+	for i, input := range inputs {
+		reader, err := input.Open(stdin)
+
+		if err != nil {
+			return err
+		}
+
+		defer reader.Close()
+
+		source := &mergeSource{index: i, input: input, scanner: NewRecordScanner(reader, input.Location)}
+
+		if err = source.next(); err != nil {
+			return err
+		}
+
+		if source.record != nil {
+			sources = append(sources, source)
+		}
+	}
+
+	heap.Init(&sources)
+
+	for len(sources) > 0 {
+		source := sources[0]
+
+		if err := handle(source.record); err != nil {
+			return err
+		}
+
+		if err := source.next(); err != nil {
+			return err
+		}
+
+		if source.record == nil {
+			heap.Pop(&sources)
+		} else {
+			heap.Fix(&sources, 0)
+		}
+	}
+
+	return nil
+}
+
+// Вход, участващ в сливането, заедно с поредния си непрочетен запис.
+type mergeSource struct {
+	index   int
+	input   *Input
+	scanner *RecordScanner
+	record  *LogRecord
+}
+
+func (s *mergeSource) next() error {
+	record, err := s.scanner.Next()
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.input.Path, err)
+	}
+
+	s.record = record
+	return nil
+}
+
+// Входовете, подредени по времето на поредния им запис, а при равно
+// време - по реда им в командния ред.
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].record.Time.Equal(h[j].record.Time) {
+		return h[i].index < h[j].index
+	}
+
+	return h[i].record.Time.Before(h[j].record.Time)
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(*mergeSource)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+func (o *OutputOptions) FormatRecord(record *LogRecord) string {
+	return strings.Join(o.FieldValues(record), " ")
+}
+
+func (o *OutputOptions) FieldValues(record *LogRecord) []string {
+	values := make([]string, 0, len(o.Fields))
+
+	for _, field := range o.Fields {
+		values = append(values, o.FieldValue(record, field))
+	}
+
+	return values
+}
+
+func (o *OutputOptions) FieldValue(record *LogRecord, field string) string {
+	switch field {
+	case "time":
+		return FormatTime(record.Time.In(o.Location), o.TimeFormat)
+	case "ip":
+		return record.IP
+	case "message":
+		return record.Message
+	}
+
+	return ""
+}
+
+func parseFields(list string) ([]string, error) {
+	fields := strings.Split(list, ",")
+
+	for _, field := range fields {
+		switch field {
+		case "time", "ip", "message":
+		default:
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	return fields, nil
+}
+
+type inputFlags struct {
+	sourceTZ *string
+}
+
+func addInputFlags(flags *flag.FlagSet) *inputFlags {
+	return &inputFlags{
+		sourceTZ: flags.String("source-tz", "UTC", "default time zone of the inputs; override per input with FILE@ZONE"),
+	}
+}
+
+func (f *inputFlags) inputs(specs []string) ([]*Input, error) {
+	location, err := LoadLocation(*f.sourceTZ)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(specs) == 0 {
+		specs = []string{"-"}
+	}
+
+	inputs := make([]*Input, 0, len(specs))
+
+	for _, spec := range specs {
+		input, err := ParseInput(spec, location)
+
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	return inputs, nil
+}
+
+type outputFlags struct {
+	fields, tz, timeFormat *string
+}
+
+func addOutputFlags(flags *flag.FlagSet) *outputFlags {
+	return &outputFlags{
+		fields:     flags.String("fields", "time,ip,message", "comma-separated fields to print: time, ip, message"),
+		tz:         flags.String("tz", "UTC", "time zone to convert timestamps to"),
+		timeFormat: flags.String("time-format", TimeFormatDefault, "rfc3339, unix or a Go time layout"),
+	}
+}
+
+func (f *outputFlags) options() (*OutputOptions, error) {
+	fields, err := parseFields(*f.fields)
+
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := LoadLocation(*f.tz)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &OutputOptions{Fields: fields, Location: location, TimeFormat: *f.timeFormat}, nil
+}
+
+// Конвейерът на extract-column: филтриране, редакция, сгъване на
+// повторенията и форматиране на избраните полета.
+type Extractor struct {
+	Output       *OutputOptions
+	Filter       *Filter
+	Redactor     *Redactor
+	Deduplicator *Deduplicator
+	// Ако Tail > 0, се извеждат само последните Tail записа.
+	Tail int
+	// Reverse извежда записите от най-новия към най-стария.
+	Reverse bool
+	Sampler RecordSampler
+	// Reservoir, ако е зададен, събира извадка от записите,
+	// която се извежда едва след края на входа.
+	Reservoir *Reservoir
+	// Table извежда подравнена таблица вместо полета, разделени с интервал.
+	Table, Color bool
+}
+
+func (e *Extractor) keep(record *LogRecord) bool {
+	if e.Filter != nil && !e.Filter.Match(record) {
+		return false
+	}
+
+	return e.Sampler == nil || e.Sampler.Keep(record)
+}
+
+func (e *Extractor) Run(inputs []*Input, stdin io.Reader, output io.Writer) error {
+	writer := bufio.NewWriter(output)
+	emit := func(record *LogRecord) {
+		fmt.Fprintln(writer, e.Output.FormatRecord(record))
+	}
+
+	var table *TableWriter
+
+	if e.Table {
+		table = NewTableWriter(writer, e.Output.Fields, e.Color)
+		emit = func(record *LogRecord) {
+			table.Add(e.Output.FieldValues(record))
+		}
+	}
+
+	process := func(record *LogRecord) error {
+		if e.Redactor != nil {
+			record.Message = e.Redactor.Redact(record.Message)
+		}
+
+		if e.Deduplicator != nil {
+			e.Deduplicator.Push(record, emit)
+		} else {
+			emit(record)
+		}
+
+		return nil
+	}
+
+	var err error
+
+	if e.Tail > 0 || e.Reverse {
+		err = e.runLast(inputs, stdin, process)
+	} else {
+		err = ForEachRecord(inputs, stdin, func(record *LogRecord) error {
+			if !e.keep(record) {
+				return nil
+			}
+
+			if e.Reservoir != nil {
+				e.Reservoir.Add(record)
+				return nil
+			}
+
+			return process(record)
+		})
+	}
+
+	if err == nil && e.Reservoir != nil {
+		for _, record := range e.Reservoir.Records() {
+			if err = process(record); err != nil {
+				break
+			}
+		}
+	}
+
+	if e.Deduplicator != nil {
+		e.Deduplicator.Flush(emit)
+	}
+
+	if table != nil {
+		table.Flush()
+	}
+
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+
+	return err
+}
+
+func (e *Extractor) runLast(inputs []*Input, stdin io.Reader, process func(*LogRecord) error) error {
+	records, err := LastRecords(inputs, stdin, e.keep, e.Tail)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		record := records[len(records)-1-i]
+
+		if e.Reverse {
+			record = records[i]
+		}
+
+		if err = process(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type filterFlags struct {
+	ip, grep *string
+}
+
+func addFilterFlags(flags *flag.FlagSet) *filterFlags {
+	return &filterFlags{
+		ip:   flags.String("ip", "", "comma-separated IP addresses or CIDR networks to keep"),
+		grep: flags.String("grep", "", "regular expression the message must match"),
+	}
+}
+
+func (f *filterFlags) filter() (*Filter, error) {
+	return ParseFilter(*f.ip, *f.grep)
+}
+
+type extractFlags struct {
+	input       *inputFlags
+	output      *outputFlags
+	filter      *filterFlags
+	dedup       *bool
+	dedupWindow *time.Duration
+	tail        *int
+	reverse     *bool
+	sampleRate  *uint64
+	sampleIPs   *uint64
+	reservoir   *int
+	seed        *uint64
+}
+
+func addExtractFlags(flags *flag.FlagSet) *extractFlags {
+	return &extractFlags{
+		input:       addInputFlags(flags),
+		output:      addOutputFlags(flags),
+		filter:      addFilterFlags(flags),
+		dedup:       flags.Bool("dedup", false, "collapse consecutive repeats of the same IP and message"),
+		dedupWindow: flags.Duration("dedup-window", 0, "collapse repeats of the same IP and message within this window (implies -dedup)"),
+		tail:        flags.Int("tail", 0, "print only the last N matching records"),
+		reverse:     flags.Bool("reverse", false, "print records from the newest to the oldest"),
+		sampleRate:  flags.Uint64("sample-rate", 0, "keep a random 1 in N records"),
+		sampleIPs:   flags.Uint64("sample-ips", 0, "keep all records of a consistent 1 in N of the IP addresses"),
+		reservoir:   flags.Int("reservoir", 0, "keep a uniform random sample of exactly K records"),
+		seed:        flags.Uint64("seed", 0, "seed for the sampling modes; 0 picks a random one"),
+	}
+}
+
+func (f *extractFlags) extractor() (extractor *Extractor, err error) {
+	extractor = &Extractor{}
+
+	if extractor.Output, err = f.output.options(); err != nil {
+		return nil, err
+	}
+
+	if extractor.Filter, err = f.filter.filter(); err != nil {
+		return nil, err
+	}
+
+	if *f.dedup || *f.dedupWindow > 0 {
+		extractor.Deduplicator = NewDeduplicator(*f.dedupWindow)
+	}
+
+	if *f.tail < 0 {
+		return nil, fmt.Errorf("-tail must not be negative")
+	}
+
+	extractor.Tail = *f.tail
+	extractor.Reverse = *f.reverse
+
+	if err = f.sampling(extractor); err != nil {
+		return nil, err
+	}
+
+	return extractor, nil
+}
+
+func (f *extractFlags) sampling(extractor *Extractor) error {
+	seed := *f.seed
+
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+
+	switch {
+	case *f.sampleRate > 0 && *f.sampleIPs > 0:
+		return fmt.Errorf("-sample-rate and -sample-ips are mutually exclusive")
+	case *f.sampleRate > 0:
+		extractor.Sampler = NewRateSampler(*f.sampleRate, seed)
+	case *f.sampleIPs > 0:
+		extractor.Sampler = &IPSampler{N: *f.sampleIPs, Seed: seed}
+	}
+
+	if *f.reservoir < 0 {
+		return fmt.Errorf("-reservoir must not be negative")
+	}
+
+	if *f.reservoir > 0 {
+		if extractor.Tail > 0 || extractor.Reverse {
+			return fmt.Errorf("-reservoir cannot be combined with -tail or -reverse")
+		}
+
+		extractor.Reservoir = NewReservoir(*f.reservoir, seed)
+	}
+
+	return nil
+}
+
+func runExtract(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("extract-column", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	extractFlags := addExtractFlags(flags)
+	redactRules := flags.String("redact", "", "JSON file with redaction rules for the message field")
+	redactKey := flags.String("redact-key-file", "", "file with a secret key for the HMAC of the hash redactions")
+	table := flags.String("table", "auto", "print an aligned table: auto (on a terminal), always or never")
+	color := flags.String("color", "auto", "colour the table: auto (on a terminal, unless NO_COLOR is set), always or never")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	inputs, err := extractFlags.input.inputs(flags.Args())
+
+	if err != nil {
+		return err
+	}
+
+	extractor, err := extractFlags.extractor()
+
+	if err != nil {
+		return err
+	}
+
+	if *redactKey != "" && *redactRules == "" {
+		return fmt.Errorf("-redact-key-file needs -redact")
+	}
+
+	if *redactRules != "" {
+		if extractor.Redactor, err = LoadRedactor(*redactRules); err != nil {
+			return err
+		}
+
+		if *redactKey != "" {
+			key, err := os.ReadFile(*redactKey)
+
+			if err != nil {
+				return err
+			}
+
+			// Ключът обикновено е записан като ред в текстов файл.
+			extractor.Redactor.Key = bytes.TrimRight(key, "\r\n")
+
+			if len(extractor.Redactor.Key) == 0 {
+				return fmt.Errorf("%s: empty key", *redactKey)
+			}
+		}
+
+		defer extractor.Redactor.WriteSummary(stderr)
+	}
+
+	isTTY := isTerminal(stdout)
+
+	if extractor.Table, err = parseWhen("-table", *table, isTTY); err != nil {
+		return err
+	}
+
+	if extractor.Color, err = parseWhen("-color", *color, isTTY && os.Getenv("NO_COLOR") == ""); err != nil {
+		return err
+	}
+
+	return extractor.Run(inputs, stdin, stdout)
+}
+
+func parseWhen(name, value string, auto bool) (bool, error) {
+	switch value {
+	case "auto":
+		return auto, nil
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("%s must be auto, always or never, found %q", name, value)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Филтър по IP адрес/мрежа и по регулярен израз върху съобщението.
+// Празен филтър пропуска всички записи.
+type Filter struct {
+	Networks []*net.IPNet
+	Pattern  *regexp.Regexp
+}
+
+// Мрежите са списък, разделен със запетаи, от CIDR блокове или отделни адреси.
+func ParseFilter(networks, pattern string) (*Filter, error) {
+	filter := &Filter{}
+
+	if networks != "" {
+		for _, network := range strings.Split(networks, ",") {
+			ipNet, err := parseNetwork(network)
+
+			if err != nil {
+				return nil, err
+			}
+
+			filter.Networks = append(filter.Networks, ipNet)
+		}
+	}
+
+	if pattern != "" {
+		compiled, err := regexp.Compile(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filter.Pattern = compiled
+	}
+
+	return filter, nil
+}
+
+func parseNetwork(network string) (*net.IPNet, error) {
+	if strings.Contains(network, "/") {
+		_, ipNet, err := net.ParseCIDR(network)
+		return ipNet, err
+	}
+
+	ip := net.ParseIP(network)
+
+	if ip == nil {
+		return nil, &net.ParseError{Type: "IP address", Text: network}
+	}
+
+	bits := 8 * net.IPv6len
+
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func (f *Filter) Match(record *LogRecord) bool {
+	if len(f.Networks) > 0 && !f.matchIP(record.IP) {
+		return false
+	}
+
+	return f.Pattern == nil || f.Pattern.MatchString(record.Message)
+}
+
+func (f *Filter) matchIP(address string) bool {
+	ip := net.ParseIP(address)
+
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range f.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Броячи, агрегирани от лога, във формата на Prometheus за текстово изложение.
+type LogMetrics struct {
+	Prefix     string
+	mutex      sync.Mutex
+	total      int
+	last       time.Time
+	byIP       map[string]int
+	byTemplate map[string]int
+}
+
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+func NewLogMetrics(prefix string, by []string) (*LogMetrics, error) {
+	if !metricNamePattern.MatchString(prefix) {
+		return nil, fmt.Errorf("invalid metric name prefix %q", prefix)
+	}
+
+	metrics := &LogMetrics{Prefix: prefix}
+
+	for _, aggregation := range by {
+		switch aggregation {
+		case "ip":
+			metrics.byIP = make(map[string]int)
+		case "template":
+			metrics.byTemplate = make(map[string]int)
+		default:
+			return nil, fmt.Errorf("unknown aggregation %q", aggregation)
+		}
+	}
+
+	return metrics, nil
+}
+
+func (m *LogMetrics) Add(record *LogRecord) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.total++
+
+	if record.Time.After(m.last) {
+		m.last = record.Time
+	}
+
+	if m.byIP != nil {
+		m.byIP[record.IP]++
+	}
+
+	if m.byTemplate != nil {
+		m.byTemplate[MessageTemplate(record.Message)]++
+	}
+}
+
+func (m *LogMetrics) WriteTo(writer io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var text strings.Builder
+
+	m.writeMetric(&text, "records_total", "counter", "Log records seen.", "", map[string]int{"": m.total})
+
+	if m.byIP != nil {
+		m.writeMetric(&text, "ip_records_total", "counter", "Log records seen, by source IP.", "ip", m.byIP)
+	}
+
+	if m.byTemplate != nil {
+		m.writeMetric(&text, "template_records_total", "counter", "Log records seen, by message template.", "template", m.byTemplate)
+	}
+
+	if !m.last.IsZero() {
+		name := m.Prefix + "_last_record_timestamp_seconds"
+		fmt.Fprintf(&text, "# HELP %s Time of the newest log record.\n# TYPE %s gauge\n%s %d\n", name, name, name, m.last.Unix())
+	}
+
+	n, err := io.WriteString(writer, text.String())
+	return int64(n), err
+}
+
+func (m *LogMetrics) writeMetric(text *strings.Builder, name, kind, help, label string, counts map[string]int) {
+	name = m.Prefix + "_" + name
+	fmt.Fprintf(text, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+
+	values := make([]string, 0, len(counts))
+
+	for value := range counts {
+		values = append(values, value)
+	}
+
+	sort.Strings(values)
+
+	for _, value := range values {
+		if label == "" {
+			fmt.Fprintf(text, "%s %d\n", name, counts[value])
+		} else {
+			fmt.Fprintf(text, "%s{%s=\"%s\"} %d\n", name, label, escapeLabelValue(value), counts[value])
+		}
+	}
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func (m *LogMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// Записва метриките атомарно (през временен файл и преименуване),
+// за да не прочете textfile collector-ът на node_exporter половин файл.
+// Файлът е четим за всички, защото node_exporter обикновено работи като
+// друг потребител.
+func (m *LogMetrics) WriteTextfile(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = m.WriteTo(file)
+
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+
+	err = errors.Join(err, file.Close())
+
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+	}
+
+	return err
+}
+
+// Чете записите на входа като tail -f: след края на файла проверява
+// за нови редове на всеки poll, докато ctx не бъде прекратен.
+// Когато стигне края на файла след нови записи (и веднъж в началото),
+// извиква idle.
+func Follow(ctx context.Context, input *Input, stdin io.Reader, poll time.Duration, handle func(*LogRecord) error, idle func() error) error {
+	reader, err := input.Open(stdin)
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+	hasNewRecords := true
+	var partial strings.Builder
+
+	for {
+		chunk, err := buffered.ReadString('\n')
+		partial.WriteString(chunk)
+
+		if err == nil {
+			line := strings.TrimSuffix(partial.String(), "\n")
+			partial.Reset()
+
+			if line == "" {
+				continue
+			}
+
+			record, err := ParseLogRecord(line, input.Location)
+
+			if err != nil {
+				return fmt.Errorf("%s: %w", input.Path, err)
+			}
+
+			if err = handle(record); err != nil {
+				return err
+			}
+
+			hasNewRecords = true
+			continue
+		}
+
+		if err != io.EOF {
+			return err
+		}
+
+		if hasNewRecords {
+			if err = idle(); err != nil {
+				return err
+			}
+
+			hasNewRecords = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+	}
+}
+
+func runMetrics(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("extract-column metrics", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	inputFlags := addInputFlags(flags)
+	filterFlags := addFilterFlags(flags)
+	by := flags.String("by", "ip,template", "comma-separated aggregations: ip, template")
+	prefix := flags.String("prefix", "extract_column", "prefix of the metric names")
+	textfile := flags.String("textfile", "", "write the metrics to this file for the node_exporter textfile collector")
+	listen := flags.String("listen", "", "serve the metrics on http://ADDR/metrics")
+	follow := flags.Bool("follow", false, "keep reading the input as it grows and keep the metrics up to date")
+	poll := flags.Duration("poll", time.Second, "how often to check the input for new records in -follow mode")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	inputs, err := inputFlags.inputs(flags.Args())
+
+	if err != nil {
+		return err
+	}
+
+	if *follow && len(inputs) != 1 {
+		return errors.New("-follow needs exactly one input")
+	}
+
+	filter, err := filterFlags.filter()
+
+	if err != nil {
+		return err
+	}
+
+	metrics, err := NewLogMetrics(*prefix, strings.Split(*by, ","))
+
+	if err != nil {
+		return err
+	}
+
+	add := func(record *LogRecord) error {
+		if filter.Match(record) {
+			metrics.Add(record)
+		}
+
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	serverErrors := make(chan error, 1)
+
+	if *listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		server := &http.Server{Addr: *listen, Handler: mux}
+
+		go func() {
+			serverErrors <- server.ListenAndServe()
+			stop()
+		}()
+
+		defer server.Close()
+	}
+
+	publish := func() error {
+		if *textfile != "" {
+			return metrics.WriteTextfile(*textfile)
+		}
+
+		return nil
+	}
+
+	if *follow {
+		err = Follow(ctx, inputs[0], stdin, *poll, add, publish)
+	} else if err = ForEachRecord(inputs, stdin, add); err == nil {
+		err = publish()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if *textfile == "" && *listen == "" {
+		_, err = metrics.WriteTo(stdout)
+		return err
+	}
+
+	if *listen != "" && !*follow {
+		<-ctx.Done()
+	}
+
+	select {
+	case err = <-serverErrors:
+		return err
+	default:
+		return nil
+	}
+}
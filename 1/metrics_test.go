@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	logContents := `2015-08-23 12:37:03 8.8.8.8 user 1 logged in
+2015-08-23 12:37:04 8.8.8.8 user 2 logged in
+2015-08-23 12:37:05 10.0.0.1 said "hi"
+`
+
+	expected := `# HELP extract_column_records_total Log records seen.
+# TYPE extract_column_records_total counter
+extract_column_records_total 3
+# HELP extract_column_ip_records_total Log records seen, by source IP.
+# TYPE extract_column_ip_records_total counter
+extract_column_ip_records_total{ip="10.0.0.1"} 1
+extract_column_ip_records_total{ip="8.8.8.8"} 2
+# HELP extract_column_template_records_total Log records seen, by message template.
+# TYPE extract_column_template_records_total counter
+extract_column_template_records_total{template="said \"hi\""} 1
+extract_column_template_records_total{template="user <num> logged in"} 2
+# HELP extract_column_last_record_timestamp_seconds Time of the newest log record.
+# TYPE extract_column_last_record_timestamp_seconds gauge
+extract_column_last_record_timestamp_seconds 1440333425
+`
+
+	testRun(t, expected, logContents, "metrics")
+}
+
+func TestMetricsTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.prom")
+
+	testRun(t, "", testLogContents, "metrics", "-by", "ip", "-prefix", "dns", "-ip", "8.8.0.0/16", "-textfile", path)
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"dns_records_total 2\n", `dns_ip_records_total{ip="8.8.4.4"} 1`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q in\n%s", expected, data)
+		}
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("Expected a world-readable textfile but found mode %v", info.Mode().Perm())
+	}
+
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left behind but found %d files", len(entries))
+	}
+}
+
+func TestMetricsRejectsInvalidPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "1st", "log-drain", "log drain"} {
+		if _, err := NewLogMetrics(prefix, nil); err == nil {
+			t.Errorf("Expected the prefix %q to be rejected", prefix)
+		}
+	}
+
+	if _, err := NewLogMetrics("log:drain_2", nil); err != nil {
+		t.Errorf("Expected a valid prefix to be accepted but found %v", err)
+	}
+}
+
+func TestFollowPicksUpAppendedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "growing.log")
+	writeTestFile(t, path, "2015-08-23 12:37:03 8.8.8.8 first\n")
+
+	metrics, _ := NewLogMetrics("log", []string{"ip"})
+	ctx, cancel := context.WithCancel(context.Background())
+	idle := make(chan struct{}, 10)
+	done := make(chan error)
+
+	go func() {
+		done <- Follow(ctx, &Input{Path: path, Location: time.UTC}, nil, time.Millisecond,
+			func(record *LogRecord) error {
+				metrics.Add(record)
+				return nil
+			},
+			func() error {
+				idle <- struct{}{}
+				return nil
+			})
+	}()
+
+	<-idle
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Редът се дописва на две части, за да се провери и незавършен ред.
+	file.WriteString("2015-08-23 12:37:04 10.0.")
+	time.Sleep(10 * time.Millisecond)
+	file.WriteString("0.1 second\n")
+	file.Close()
+
+	<-idle
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var text bytes.Buffer
+	metrics.WriteTo(&text)
+
+	for _, expected := range []string{"log_records_total 2\n", `log_ip_records_total{ip="10.0.0.1"} 1`} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("Expected %q in\n%s", expected, text.String())
+		}
+	}
+}
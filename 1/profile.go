@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	KindTimestamp = "timestamp"
+	KindDate      = "date"
+	KindTime      = "time"
+	KindIP        = "ip"
+	KindNumber    = "number"
+	KindText      = "text"
+)
+
+// Колона е фиксирано поле, ако поне толкова от стойностите ѝ са от един вид
+// или ако има малко различни стойности (например ниво на лога).
+const dominantKindRatio = 0.9
+
+func guessKind(value string) string {
+	if _, err := time.Parse(time.RFC3339, value); err == nil {
+		return KindTimestamp
+	}
+
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		return KindDate
+	}
+
+	if _, err := time.Parse("15:04:05", value); err == nil {
+		return KindTime
+	}
+
+	if net.ParseIP(value) != nil {
+		return KindIP
+	}
+
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return KindNumber
+	}
+
+	return KindText
+}
+
+func isMissing(value string) bool {
+	return value == "" || value == "-"
+}
+
+type ValueCount struct {
+	Value string
+	Count int
+}
+
+// Профил на едно поле от лога. Полето обхваща колоните от FirstColumn
+// до LastColumn включително, а LastColumn == -1 значи "до края на реда".
+type FieldProfile struct {
+	Kind                    string
+	FirstColumn, LastColumn int
+	Count, Missing          int
+	Min, Max                string
+	values                  map[string]int
+}
+
+func (f *FieldProfile) Cardinality() int {
+	return len(f.values)
+}
+
+func (f *FieldProfile) MissingRate() float64 {
+	if f.Count == 0 {
+		return 0
+	}
+
+	return float64(f.Missing) / float64(f.Count)
+}
+
+func (f *FieldProfile) Top(n int) []ValueCount {
+	top := make([]ValueCount, 0, len(f.values))
+
+	for value, count := range f.values {
+		top = append(top, ValueCount{value, count})
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+
+		return top[i].Value < top[j].Value
+	})
+
+	if len(top) > n {
+		top = top[:n]
+	}
+
+	return top
+}
+
+func (f *FieldProfile) value(cols []string) string {
+	if f.FirstColumn >= len(cols) {
+		return ""
+	}
+
+	if f.LastColumn == -1 || f.LastColumn >= len(cols) {
+		return strings.Join(cols[f.FirstColumn:], " ")
+	}
+
+	return strings.Join(cols[f.FirstColumn:f.LastColumn+1], " ")
+}
+
+func (f *FieldProfile) add(value string) {
+	f.Count++
+
+	if isMissing(value) {
+		f.Missing++
+		return
+	}
+
+	f.values[value]++
+
+	if f.Min == "" || f.less(value, f.Min) {
+		f.Min = value
+	}
+
+	if f.Max == "" || f.less(f.Max, value) {
+		f.Max = value
+	}
+}
+
+func (f *FieldProfile) less(a, b string) bool {
+	switch f.Kind {
+	case KindNumber:
+		x, errX := strconv.ParseFloat(a, 64)
+		y, errY := strconv.ParseFloat(b, 64)
+
+		if errX == nil && errY == nil {
+			return x < y
+		}
+	case KindIP:
+		x, y := net.ParseIP(a), net.ParseIP(b)
+
+		if x != nil && y != nil {
+			return string(x.To16()) < string(y.To16())
+		}
+	}
+
+	return a < b
+}
+
+type LogProfile struct {
+	Lines  int
+	Fields []*FieldProfile
+}
+
+// Профилира до sample непразни реда от непознат лог: отгатва кои колони
+// са фиксирани полета и какви са, а остатъкът от реда се смята за текст.
+func ProfileLog(reader io.Reader, sample int) (*LogProfile, error) {
+	var rows [][]string
+	scanner := bufio.NewScanner(reader)
+
+	for len(rows) < sample && scanner.Scan() {
+		if cols := strings.Fields(scanner.Text()); len(cols) > 0 {
+			rows = append(rows, cols)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	profile := &LogProfile{Lines: len(rows), Fields: guessLayout(rows)}
+
+	for _, cols := range rows {
+		for _, field := range profile.Fields {
+			field.add(field.value(cols))
+		}
+	}
+
+	return profile, nil
+}
+
+func guessLayout(rows [][]string) []*FieldProfile {
+	var fields []*FieldProfile
+
+	for column := 0; ; column++ {
+		kinds := make(map[string]int)
+		distinct := make(map[string]bool)
+		present := 0
+
+		for _, cols := range rows {
+			if column < len(cols) {
+				kinds[guessKind(cols[column])]++
+				distinct[cols[column]] = true
+				present++
+			}
+		}
+
+		if present == 0 {
+			return fields
+		}
+
+		kind, kindCount := KindText, 0
+
+		for k, count := range kinds {
+			if count > kindCount || (count == kindCount && k < kind) {
+				kind, kindCount = k, count
+			}
+		}
+
+		isFixed := float64(present) >= dominantKindRatio*float64(len(rows)) &&
+			((kind != KindText && float64(kindCount) >= dominantKindRatio*float64(present)) ||
+				isLowCardinality(len(distinct), present))
+
+		if !isFixed {
+			fields = append(fields, newFieldProfile(KindText, column, -1))
+			return fields
+		}
+
+		if kind == KindTime && len(fields) > 0 {
+			if previous := fields[len(fields)-1]; previous.Kind == KindDate && previous.LastColumn == column-1 {
+				previous.Kind = KindTimestamp
+				previous.LastColumn = column
+				continue
+			}
+		}
+
+		fields = append(fields, newFieldProfile(kind, column, column))
+	}
+}
+
+// Малко са различните стойности, ако са не повече от корен от броя им.
+func isLowCardinality(distinct, present int) bool {
+	return distinct < present && float64(distinct) <= math.Sqrt(float64(present))
+}
+
+func newFieldProfile(kind string, firstColumn, lastColumn int) *FieldProfile {
+	return &FieldProfile{
+		Kind:        kind,
+		FirstColumn: firstColumn,
+		LastColumn:  lastColumn,
+		values:      make(map[string]int),
+	}
+}
+
+func (p *LogProfile) Write(writer io.Writer, top int) {
+	fmt.Fprintf(writer, "sampled %d lines, %d fields\n", p.Lines, len(p.Fields))
+
+	for i, field := range p.Fields {
+		columns := fmt.Sprintf("column %d", field.FirstColumn)
+
+		if field.LastColumn == -1 {
+			columns = fmt.Sprintf("columns %d-", field.FirstColumn)
+		} else if field.LastColumn != field.FirstColumn {
+			columns = fmt.Sprintf("columns %d-%d", field.FirstColumn, field.LastColumn)
+		}
+
+		fmt.Fprintf(writer, "\nfield %d: %s (%s)\n", i, field.Kind, columns)
+		fmt.Fprintf(writer, "  cardinality: %d\n", field.Cardinality())
+		fmt.Fprintf(writer, "  missing: %.1f%%\n", 100*field.MissingRate())
+
+		if field.Min != "" {
+			fmt.Fprintf(writer, "  min: %s\n", field.Min)
+			fmt.Fprintf(writer, "  max: %s\n", field.Max)
+		}
+
+		fmt.Fprintln(writer, "  top values:")
+
+		for _, value := range field.Top(top) {
+			fmt.Fprintf(writer, "    %d\t%s\n", value.Count, value.Value)
+		}
+	}
+}
+
+func runProfile(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("extract-column profile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	sample := flags.Int("sample", 1000, "number of lines to sample")
+	top := flags.Int("top", 5, "number of top values to report per field")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() > 1 {
+		return errors.New("profile takes at most one input")
+	}
+
+	input := &Input{Path: flags.Arg(0)}
+
+	if input.Path == "" {
+		input.Path = "-"
+	}
+
+	reader, err := input.Open(stdin)
+
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	profile, err := ProfileLog(reader, *sample)
+
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(stdout)
+	profile.Write(writer, *top)
+	return writer.Flush()
+}
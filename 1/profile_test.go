@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testProfileLogContents = `2015-08-23 12:37:03 INFO 8.8.8.8 200 As far as we can tell this is a DNS
+2015-08-23 12:37:04 INFO 8.8.4.4 200 Yet another DNS, how quaint!
+2015-08-23 12:37:05 WARN 208.122.23.23 503 There is definitely some trend here
+2015-08-23 12:37:06 INFO 8.8.8.8 - Nothing to report
+2015-08-23 12:37:07 INFO 8.8.8.8 404 Not found
+2015-08-23 12:37:08 INFO 10.0.0.1 200 Fine
+2015-08-23 12:37:09 INFO 10.0.0.2 200 Still fine
+2015-08-23 12:37:10 INFO 10.0.0.3 200 Very fine
+2015-08-23 12:37:11 INFO 10.0.0.4 200 Extremely fine
+2015-08-23 12:37:12 INFO 10.0.0.5 200 Last one
+`
+
+func TestProfileGuessesLayout(t *testing.T) {
+	profile, err := ProfileLog(strings.NewReader(testProfileLogContents), 1000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []FieldProfile{
+		{Kind: KindTimestamp, FirstColumn: 0, LastColumn: 1, Min: "2015-08-23 12:37:03", Max: "2015-08-23 12:37:12"},
+		{Kind: KindText, FirstColumn: 2, LastColumn: 2, Min: "INFO", Max: "WARN"},
+		{Kind: KindIP, FirstColumn: 3, LastColumn: 3, Min: "8.8.4.4", Max: "208.122.23.23"},
+		{Kind: KindNumber, FirstColumn: 4, LastColumn: 4, Missing: 1, Min: "200", Max: "503"},
+		{Kind: KindText, FirstColumn: 5, LastColumn: -1, Min: "As far as we can tell this is a DNS", Max: "Yet another DNS, how quaint!"},
+	}
+
+	if profile.Lines != 10 || len(profile.Fields) != len(expected) {
+		t.Fatalf("Expected 10 lines and %d fields but found %d and %d", len(expected), profile.Lines, len(profile.Fields))
+	}
+
+	for i, field := range profile.Fields {
+		e := expected[i]
+
+		if field.Kind != e.Kind || field.FirstColumn != e.FirstColumn || field.LastColumn != e.LastColumn ||
+			field.Missing != e.Missing || field.Min != e.Min || field.Max != e.Max {
+			t.Errorf("Expected field %d to be %+v but found %+v", i, e, *field)
+		}
+	}
+
+	if top := profile.Fields[1].Top(1); top[0] != (ValueCount{"INFO", 9}) {
+		t.Errorf("Expected INFO to be the top level but found %v", top)
+	}
+
+	if cardinality := profile.Fields[1].Cardinality(); cardinality != 2 {
+		t.Errorf("Expected 2 distinct levels but found %d", cardinality)
+	}
+}
+
+func TestProfileCommand(t *testing.T) {
+	var stdout bytes.Buffer
+
+	if err := run([]string{"profile", "-sample", "3", "-top", "1"}, strings.NewReader(testLogContents), &stdout, &stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"sampled 3 lines, 3 fields", "field 0: timestamp (columns 0-1)", "field 1: ip (column 2)", "field 2: text (columns 3-)", "missing: 0.0%"} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("Expected the report to contain %q but found\n%s", expected, stdout.String())
+		}
+	}
+}
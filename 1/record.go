@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const logTimeLayout = "2006-01-02 15:04:05"
+
+type LogRecord struct {
+	Time    time.Time
+	IP      string
+	Message string
+}
+
+type MalformedLineError struct {
+	Line string
+}
+
+func (e *MalformedLineError) Error() string {
+	return fmt.Sprintf("malformed log line %q", e.Line)
+}
+
+// Разбива ред от лога на време, IP адрес и съобщение.
+// Времето в лога няма зона, затова се тълкува спрямо location.
+func ParseLogRecord(line string, location *time.Location) (*LogRecord, error) {
+	cols := strings.SplitN(line, " ", 4)
+
+	if len(cols) < 3 {
+		return nil, &MalformedLineError{line}
+	}
+
+	recordTime, err := time.ParseInLocation(logTimeLayout, cols[0]+" "+cols[1], location)
+
+	if err != nil {
+		return nil, &MalformedLineError{line}
+	}
+
+	record := &LogRecord{Time: recordTime, IP: cols[2]}
+
+	if len(cols) == 4 {
+		record.Message = cols[3]
+	}
+
+	return record, nil
+}
+
+// Чете записите от reader един по един и ги подава на handle.
+// Празните редове се прескачат, както в ExtractColumn.
+func ScanLogRecords(reader io.Reader, location *time.Location, handle func(*LogRecord) error) error {
+	scanner := NewRecordScanner(reader, location)
+
+	for {
+		record, err := scanner.Next()
+
+		if record == nil || err != nil {
+			return err
+		}
+
+		if err = handle(record); err != nil {
+			return err
+		}
+	}
+}
+
+// Чете записите от reader при поискване, например за да се слеят
+// няколко входа едновременно.
+type RecordScanner struct {
+	scanner  *bufio.Scanner
+	location *time.Location
+}
+
+func NewRecordScanner(reader io.Reader, location *time.Location) *RecordScanner {
+	return &RecordScanner{scanner: bufio.NewScanner(reader), location: location}
+}
+
+// Следващият запис или nil в края на входа. Празните редове се прескачат.
+func (s *RecordScanner) Next() (*LogRecord, error) {
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+
+		if line == "" {
+			continue
+		}
+
+		return ParseLogRecord(line, s.location)
+	}
+
+	return nil, s.scanner.Err()
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	RedactMask = "mask"
+	RedactHash = "hash"
+)
+
+// Ако pattern има група value, редактира се само тя, а останалата част
+// от съвпадението (например граница пред стойността) се запазва.
+type detector struct {
+	pattern *regexp.Regexp
+	isValid func(match string) bool
+	// Ако е зададен, текстът след стойността трябва да го удовлетворява,
+	// иначе стойността е част от по-дълга дума.
+	isEnd func(rest string) bool
+	// Ако е зададен, вместо isValid намира в съвпадението началото и
+	// края на всяка стойност за редакция.
+	find func(match string) [][2]int
+}
+
+var detectors = map[string]*detector{
+	"email": {
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"ipv4": {
+		pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+		isValid: func(match string) bool { return net.ParseIP(match) != nil },
+	},
+	"ipv6": {
+		pattern: regexp.MustCompile(`(?:^|[^0-9A-Za-z:.])(?P<value>[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}(?:(?:\.\d{1,3}){3})?)`),
+		isValid: isIPv6,
+		isEnd:   isIPv6End,
+	},
+	"jwt": {
+		pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	"creditcard": {
+		// Цялата поредица от групи цифри; номерата в нея намира cardNumbers.
+		pattern: regexp.MustCompile(`\b\d+(?:[ -]\d+)*\b`),
+		find:    cardNumbers,
+	},
+}
+
+// Правило за редакция: или именуван детектор, или регулярен израз (ако
+// има група value, редактира се само тя). Съвпаденията се маскират
+// (Replacement или "[REDACTED]") или се заменят с кратък хеш, за да могат
+// да се съпоставят.
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Detector    string `json:"detector"`
+	Regex       string `json:"regex"`
+	Action      string `json:"action"`
+	Replacement string `json:"replacement"`
+
+	detector *detector
+}
+
+type Redactor struct {
+	Rules  []*RedactionRule
+	Counts map[string]int
+	// Ключ за хешовете (HMAC-SHA256). Без ключ хешът е обикновен SHA-256
+	// и кратките стойности като IP адреси се възстановяват с пълно изброяване.
+	Key []byte
+}
+
+func NewRedactor(rules []*RedactionRule) (*Redactor, error) {
+	for _, rule := range rules {
+		switch {
+		case rule.Detector != "" && rule.Regex != "":
+			return nil, fmt.Errorf("rule %q: detector and regex are mutually exclusive", rule.Name)
+		case rule.Detector != "":
+			rule.detector = detectors[rule.Detector]
+
+			if rule.detector == nil {
+				return nil, fmt.Errorf("rule %q: unknown detector %q", rule.Name, rule.Detector)
+			}
+		case rule.Regex != "":
+			pattern, err := regexp.Compile(rule.Regex)
+
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+
+			rule.detector = &detector{pattern: pattern}
+		default:
+			return nil, fmt.Errorf("rule %q: either detector or regex is required", rule.Name)
+		}
+
+		switch rule.Action {
+		case "":
+			rule.Action = RedactMask
+		case RedactMask, RedactHash:
+		default:
+			return nil, fmt.Errorf("rule %q: unknown action %q", rule.Name, rule.Action)
+		}
+
+		if rule.Name == "" {
+			rule.Name = rule.Detector
+		}
+	}
+
+	return &Redactor{Rules: rules, Counts: make(map[string]int)}, nil
+}
+
+// Зарежда правилата от JSON файл - масив от RedactionRule.
+func LoadRedactor(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*RedactionRule
+
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return NewRedactor(rules)
+}
+
+func (r *Redactor) Redact(message string) string {
+	for _, rule := range r.Rules {
+		message = rule.detector.replaceAll(message, func(match string) string {
+			r.Counts[rule.Name]++
+			return r.replace(rule, match)
+		})
+	}
+
+	return message
+}
+
+func (r *Redactor) WriteSummary(writer io.Writer) {
+	fmt.Fprintln(writer, "redactions by rule:")
+
+	for _, rule := range r.Rules {
+		fmt.Fprintf(writer, "%s\t%d\n", rule.Name, r.Counts[rule.Name])
+	}
+}
+
+// Заменя с replace всяка валидна стойност, намерена от детектора.
+func (d *detector) replaceAll(message string, replace func(match string) string) string {
+	var (
+		result strings.Builder
+		last   int
+	)
+
+	group := d.pattern.SubexpIndex("value")
+
+	for _, indices := range d.pattern.FindAllStringSubmatchIndex(message, -1) {
+		start, end := indices[0], indices[1]
+
+		if group > 0 {
+			start, end = indices[2*group], indices[2*group+1]
+		}
+
+		if start < 0 {
+			continue
+		}
+
+		match := message[start:end]
+
+		if d.find != nil {
+			for _, span := range d.find(match) {
+				result.WriteString(message[last : start+span[0]])
+				result.WriteString(replace(match[span[0]:span[1]]))
+				last = start + span[1]
+			}
+
+			continue
+		}
+
+		if d.isValid != nil && !d.isValid(match) {
+			continue
+		}
+
+		if d.isEnd != nil && !d.isEnd(message[end:]) {
+			continue
+		}
+
+		result.WriteString(message[last:start])
+		result.WriteString(replace(match))
+		last = end
+	}
+
+	result.WriteString(message[last:])
+	return result.String()
+}
+
+func (r *Redactor) replace(rule *RedactionRule, match string) string {
+	if rule.Action == RedactHash {
+		var sum []byte
+
+		if len(r.Key) > 0 {
+			mac := hmac.New(sha256.New, r.Key)
+			mac.Write([]byte(match))
+			sum = mac.Sum(nil)
+		} else {
+			digest := sha256.Sum256([]byte(match))
+			sum = digest[:]
+		}
+
+		return rule.Name + ":" + hex.EncodeToString(sum[:6])
+	}
+
+	if rule.Replacement != "" {
+		return rule.Replacement
+	}
+
+	return "[REDACTED]"
+}
+
+// Адрес с поне две непразни групи, за да не се бърка с
+// "::" или "a:" в обикновен текст.
+func isIPv6(match string) bool {
+	if net.ParseIP(match) == nil {
+		return false
+	}
+
+	groups := 0
+
+	for _, group := range strings.Split(match, ":") {
+		if group != "" {
+			groups++
+		}
+	}
+
+	return groups >= 2
+}
+
+// Адресът не продължава с букви, цифри, ":" или ".цифра" (например
+// недовършен вграден IPv4 адрес), но може да е в края на изречение.
+func isIPv6End(rest string) bool {
+	if rest == "" {
+		return true
+	}
+
+	if next := rest[0]; next == ':' || isAlphanumeric(next) {
+		return false
+	}
+
+	return !(rest[0] == '.' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9')
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+// Номерата на карти в поредица от групи цифри: отляво надясно, най-дългата
+// поредица от цели групи с 13-19 цифри, която минава проверката на Luhn.
+// Така номерът се намира и когато пред или след него има други числа.
+func cardNumbers(run string) [][2]int {
+	starts := []int{0}
+	var ends []int
+
+	for i := 0; i < len(run); i++ {
+		if run[i] == ' ' || run[i] == '-' {
+			ends = append(ends, i)
+			starts = append(starts, i+1)
+		}
+	}
+
+	ends = append(ends, len(run))
+
+	var spans [][2]int
+
+	for i := 0; i < len(starts); i++ {
+		for j := len(ends) - 1; j >= i; j-- {
+			if isLuhnValid(run[starts[i]:ends[j]]) {
+				spans = append(spans, [2]int{starts[i], ends[j]})
+				i = j
+				break
+			}
+		}
+	}
+
+	return spans
+}
+
+func isLuhnValid(number string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+
+		return r
+	}, number)
+
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+
+		if (len(digits)-i)%2 == 0 {
+			digit *= 2
+
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+
+		sum += digit
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactDetectors(t *testing.T) {
+	redactor, err := NewRedactor([]*RedactionRule{
+		{Detector: "email"},
+		{Detector: "jwt"},
+		{Detector: "creditcard", Replacement: "[CARD]"},
+		{Detector: "ipv4"},
+		{Detector: "ipv6"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for message, expected := range map[string]string{
+		"login by ivan@example.com failed":                   "login by [REDACTED] failed",
+		"token eyJhbGciOi.eyJzdWIiOjF9.c2lnbmF0dXJl expired": "token [REDACTED] expired",
+		"paid with 4111 1111 1111 1111":                      "paid with [CARD]",
+		"order 4111 1111 1111 1112 is not a card":            "order 4111 1111 1111 1112 is not a card",
+		"forwarded for 10.1.2.3 via fe80::1":                 "forwarded for [REDACTED] via [REDACTED]",
+		"version 999.1.2.3 at 12:37:03":                      "version 999.1.2.3 at 12:37:03",
+	} {
+		if found := redactor.Redact(message); found != expected {
+			t.Errorf("Expected %q but found %q", expected, found)
+		}
+	}
+
+	for name, expected := range map[string]int{"email": 1, "jwt": 1, "creditcard": 1, "ipv4": 1, "ipv6": 1} {
+		if redactor.Counts[name] != expected {
+			t.Errorf("Expected %d redactions by %s but found %d", expected, name, redactor.Counts[name])
+		}
+	}
+}
+
+func TestRedactDetectorBoundaries(t *testing.T) {
+	redactor, err := NewRedactor([]*RedactionRule{
+		{Detector: "creditcard", Replacement: "[CARD]"},
+		{Detector: "ipv6"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for message, expected := range map[string]string{
+		"paid with 4111 1111 1111 1111 12 items":     "paid with [CARD] 12 items",
+		"paid 4111111111111111 2024":                 "paid [CARD] 2024",
+		"order 12 4111 1111 1111 1111":               "order 12 [CARD]",
+		"cards 4111111111111111 5500-0000-0000-0004": "cards [CARD] [CARD]",
+		"id 41111111111111111111 is too long":        "id 41111111111111111111 is too long",
+		"peers fe80::1,2001:db8::8a2e:370:7334.":     "peers [REDACTED],[REDACTED].",
+		"mapped ::ffff:10.1.2.3 closed":              "mapped [REDACTED] closed",
+		"std::cout << x::y in abc::def12":            "std::cout << x::y in abc::def12",
+		"loopback ::1 and ratio 1:2:3":               "loopback ::1 and ratio 1:2:3",
+		"id xfe80::1 and fe80::1x are not hosts":     "id xfe80::1 and fe80::1x are not hosts",
+	} {
+		if found := redactor.Redact(message); found != expected {
+			t.Errorf("Expected %q but found %q", expected, found)
+		}
+	}
+}
+
+func TestRedactHashIsConsistent(t *testing.T) {
+	redactor, err := NewRedactor([]*RedactionRule{{Name: "user", Regex: `user=\w+`, Action: RedactHash}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := redactor.Redact("user=ivan logged in")
+	second := redactor.Redact("user=ivan logged out")
+
+	if strings.Contains(first, "ivan") || strings.TrimSuffix(first, " logged in") != strings.TrimSuffix(second, " logged out") {
+		t.Errorf("Expected the same hash for the same value but found %q and %q", first, second)
+	}
+}
+
+func TestRedactInvalidRules(t *testing.T) {
+	for _, rule := range []*RedactionRule{
+		{Name: "none"},
+		{Name: "both", Detector: "email", Regex: "x"},
+		{Name: "unknown", Detector: "passport"},
+		{Name: "regex", Regex: "("},
+		{Name: "action", Detector: "email", Action: "encrypt"},
+	} {
+		if _, err := NewRedactor([]*RedactionRule{rule}); err == nil {
+			t.Errorf("Expected an error for rule %q", rule.Name)
+		}
+	}
+}
+
+func TestRedactFlagReportsSummary(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "rules.json")
+	writeTestFile(t, rules, `[{"name": "mail", "detector": "email"}]`)
+
+	var stdout, stderr bytes.Buffer
+	logContents := `2015-08-23 12:37:03 10.0.0.1 mail from a@b.com to c@d.org
+2015-08-23 12:37:04 10.0.0.1 nothing to hide
+`
+
+	if err := run([]string{"-redact", rules, "-fields", "message"}, strings.NewReader(logContents), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "mail from [REDACTED] to [REDACTED]\nnothing to hide\n"
+
+	if stdout.String() != expected {
+		t.Errorf("Expected %q but found %q", expected, stdout.String())
+	}
+
+	if !strings.Contains(stderr.String(), "mail\t2\n") {
+		t.Errorf("Expected a summary with 2 redactions but found %q", stderr.String())
+	}
+}
+
+func TestRedactHashWithKey(t *testing.T) {
+	redactor, err := NewRedactor([]*RedactionRule{{Name: "user", Regex: `user=\w+`, Action: RedactHash}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unkeyed := redactor.Redact("user=ivan")
+	redactor.Key = []byte("secret")
+	keyed := redactor.Redact("user=ivan")
+
+	if unkeyed == keyed {
+		t.Errorf("Expected the key to change the hash but found %q and %q", unkeyed, keyed)
+	}
+
+	redactor.Key = []byte("another secret")
+
+	if other := redactor.Redact("user=ivan"); other == keyed {
+		t.Errorf("Expected different keys to give different hashes but found %q", other)
+	}
+}
+
+func TestRedactKeyFileFlag(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules.json")
+	key := filepath.Join(dir, "key")
+	writeTestFile(t, rules, `[{"name": "mail", "detector": "email", "action": "hash"}]`)
+	writeTestFile(t, key, "secret\n")
+	logContents := "2015-08-23 12:37:03 10.0.0.1 mail from a@b.com\n"
+
+	var stdout bytes.Buffer
+
+	if err := run([]string{"-redact", rules, "-redact-key-file", key, "-fields", "message"}, strings.NewReader(logContents), &stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	redactor, _ := NewRedactor([]*RedactionRule{{Name: "mail", Detector: "email", Action: RedactHash}})
+	redactor.Key = []byte("secret")
+
+	if expected := redactor.Redact("mail from a@b.com") + "\n"; stdout.String() != expected {
+		t.Errorf("Expected %q but found %q", expected, stdout.String())
+	}
+
+	if err := run([]string{"-redact-key-file", key}, strings.NewReader(logContents), io.Discard, io.Discard); err == nil {
+		t.Error("Expected -redact-key-file without -redact to be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand/v2"
+	"sort"
+)
+
+type RecordSampler interface {
+	Keep(record *LogRecord) bool
+}
+
+// Пропуска средно по един от всеки N записа.
+type RateSampler struct {
+	N      uint64
+	random *rand.Rand
+}
+
+func NewRateSampler(n, seed uint64) *RateSampler {
+	return &RateSampler{N: n, random: rand.New(rand.NewPCG(seed, n))}
+}
+
+func (s *RateSampler) Keep(record *LogRecord) bool {
+	return s.random.Uint64N(s.N) == 0
+}
+
+// Избира средно един от всеки N IP адреса и пропуска всички записи от него.
+// Изборът зависи само от адреса и seed, така че е един и същ между пусканията
+// и между различни логове.
+type IPSampler struct {
+	N    uint64
+	Seed uint64
+}
+
+func (s *IPSampler) Keep(record *LogRecord) bool {
+	hash := fnv.New64a()
+	binary.Write(hash, binary.LittleEndian, s.Seed)
+	hash.Write([]byte(record.IP))
+	return hash.Sum64()%s.N == 0
+}
+
+type sampledRecord struct {
+	index  int
+	record *LogRecord
+}
+
+// Равномерна извадка от точно K записа (или всички, ако са по-малко),
+// без потокът да се държи в паметта (алгоритъм R).
+type Reservoir struct {
+	K       int
+	seen    int
+	samples []sampledRecord
+	random  *rand.Rand
+}
+
+func NewReservoir(k int, seed uint64) *Reservoir {
+	return &Reservoir{K: k, random: rand.New(rand.NewPCG(seed, uint64(k)))}
+}
+
+func (r *Reservoir) Add(record *LogRecord) {
+	if len(r.samples) < r.K {
+		r.samples = append(r.samples, sampledRecord{r.seen, record})
+	} else if j := r.random.IntN(r.seen + 1); j < r.K {
+		r.samples[j] = sampledRecord{r.seen, record}
+	}
+
+	r.seen++
+}
+
+// Връща извадката в реда, в който записите са постъпили.
+func (r *Reservoir) Records() []*LogRecord {
+	sort.Slice(r.samples, func(i, j int) bool {
+		return r.samples[i].index < r.samples[j].index
+	})
+
+	records := make([]*LogRecord, len(r.samples))
+
+	for i, sample := range r.samples {
+		records[i] = sample.record
+	}
+
+	return records
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testSampleLog(lines, ips int) string {
+	var log strings.Builder
+
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&log, "2015-08-23 12:%02d:%02d 10.0.%d.%d line %d\n", i/60%60, i%60, i%ips/256, i%ips%256, i)
+	}
+
+	return log.String()
+}
+
+func runSample(t *testing.T, stdin string, args ...string) string {
+	var stdout bytes.Buffer
+
+	if err := run(args, strings.NewReader(stdin), &stdout, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	return stdout.String()
+}
+
+func TestSamplingIsReproducible(t *testing.T) {
+	log := testSampleLog(1000, 50)
+
+	for _, mode := range [][]string{{"-sample-rate", "10"}, {"-sample-ips", "5"}, {"-reservoir", "20"}} {
+		first := runSample(t, log, append(mode, "-seed", "42")...)
+		second := runSample(t, log, append(mode, "-seed", "42")...)
+		other := runSample(t, log, append(mode, "-seed", "43")...)
+
+		if first != second {
+			t.Errorf("Expected %v with the same seed to give the same sample", mode)
+		}
+
+		if first == other {
+			t.Errorf("Expected %v with a different seed to give a different sample", mode)
+		}
+	}
+}
+
+func TestRateSampler(t *testing.T) {
+	lines := strings.Count(runSample(t, testSampleLog(10000, 50), "-sample-rate", "10", "-seed", "1"), "\n")
+
+	if lines < 800 || lines > 1200 {
+		t.Errorf("Expected about 1000 of 10000 records with 1 in 10 sampling but found %d", lines)
+	}
+}
+
+func TestIPSamplerKeepsWholeIPs(t *testing.T) {
+	sampled := runSample(t, testSampleLog(1000, 50), "-sample-ips", "5", "-seed", "7", "-fields", "ip")
+	counts := make(map[string]int)
+
+	for _, ip := range strings.Fields(sampled) {
+		counts[ip]++
+	}
+
+	if len(counts) == 0 || len(counts) == 50 {
+		t.Fatalf("Expected some but not all of the 50 IPs to be sampled but found %d", len(counts))
+	}
+
+	for ip, count := range counts {
+		if count != 20 {
+			t.Errorf("Expected all 20 records of %s but found %d", ip, count)
+		}
+	}
+}
+
+func TestReservoirKeepsExactlyKInOrder(t *testing.T) {
+	reservoir := NewReservoir(20, 3)
+	records := make([]*LogRecord, 1000)
+
+	for i := range records {
+		records[i] = &LogRecord{Message: fmt.Sprint(i)}
+		reservoir.Add(records[i])
+	}
+
+	sample := reservoir.Records()
+
+	if len(sample) != 20 {
+		t.Fatalf("Expected 20 records but found %d", len(sample))
+	}
+
+	previous := -1
+
+	for _, record := range sample {
+		var index int
+		fmt.Sscan(record.Message, &index)
+
+		if index <= previous {
+			t.Errorf("Expected the sample in input order but found %d after %d", index, previous)
+		}
+
+		previous = index
+	}
+
+	small := NewReservoir(20, 3)
+	small.Add(records[0])
+
+	if len(small.Records()) != 1 {
+		t.Errorf("Expected all records when there are fewer than K")
+	}
+}
+
+func TestReservoirRejectsTail(t *testing.T) {
+	if err := run([]string{"-reservoir", "5", "-tail", "5"}, strings.NewReader(""), io.Discard, io.Discard); err == nil {
+		t.Errorf("Expected -reservoir with -tail to be rejected")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+const extractErrorTrailer = "X-Extract-Error"
+
+// HTTP интерфейс към Extractor. Параметрите на заявката са същите като
+// флаговете на extract-column (fields, tz, ip, grep, dedup и т.н.).
+// Логът е тялото на POST заявката или файл под Root, зададен с параметъра file.
+type Server struct {
+	Root *os.Root
+}
+
+func NewServeMux(server *Server) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/extract", server)
+	return mux
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	flags := flag.NewFlagSet("extract", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	extractFlags := addExtractFlags(flags)
+
+	for name, values := range query {
+		if name == "file" {
+			continue
+		}
+
+		for _, value := range values {
+			if err := flags.Set(name, value); err != nil {
+				http.Error(w, fmt.Sprintf("parameter %s: %v", name, err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	inputs, err := extractFlags.input.inputs(nil)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	extractor, err := extractFlags.extractor()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body io.Reader
+
+	switch name := query.Get("file"); {
+	case name != "":
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if s.Root == nil {
+			http.Error(w, "no root directory configured", http.StatusNotFound)
+			return
+		}
+
+		file, err := s.Root.Open(name)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		defer file.Close()
+		body = file
+	case r.Method == http.MethodPost:
+		body = r.Body
+	default:
+		http.Error(w, "POST a log or name a file", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Отговорът се пише поточно, затова грешка по средата на лога
+	// може да се съобщи само в trailer.
+	w.Header().Set("Trailer", extractErrorTrailer)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if err = extractor.Run(inputs, body, w); err != nil {
+		w.Header().Set(extractErrorTrailer, err.Error())
+	}
+}
+
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("extract-column serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	rootDir := flags.String("root", "", "directory with logs that clients may name with the file parameter")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	server := &Server{}
+
+	if *rootDir != "" {
+		root, err := os.OpenRoot(*rootDir)
+
+		if err != nil {
+			return err
+		}
+
+		defer root.Close()
+		server.Root = root
+	}
+
+	log.New(stderr, "", log.LstdFlags).Printf("listening on %s", *addr)
+	return http.ListenAndServe(*addr, NewServeMux(server))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServePostedLog(t *testing.T) {
+	server := httptest.NewServer(NewServeMux(&Server{}))
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/extract?fields=ip,message&ip=8.8.0.0/16", "text/plain", strings.NewReader(testLogContents))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `8.8.8.8 As far as we can tell this is a DNS
+8.8.4.4 Yet another DNS, how quaint!
+`
+
+	testResponse(t, response, http.StatusOK, expected)
+}
+
+func TestServeFileUnderRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "dns.log"), testLogContents)
+	root, err := os.OpenRoot(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer root.Close()
+
+	server := httptest.NewServer(NewServeMux(&Server{Root: root}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/extract?file=dns.log&fields=time&time-format=unix&grep=trend")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testResponse(t, response, http.StatusOK, "1440333425\n")
+
+	response, err = http.Get(server.URL + "/extract?file=../outside.log")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a file outside the root to be rejected but found %s", response.Status)
+	}
+}
+
+func TestServeRejectsBadParameters(t *testing.T) {
+	server := httptest.NewServer(NewServeMux(&Server{}))
+	defer server.Close()
+
+	for _, query := range []string{"fields=port", "unknown=1", "ip=not-an-ip"} {
+		response, err := http.Post(server.URL+"/extract?"+query, "text/plain", strings.NewReader(testLogContents))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected but found %s", query, response.Status)
+		}
+	}
+}
+
+func TestServeReportsMalformedLogInTrailer(t *testing.T) {
+	server := httptest.NewServer(NewServeMux(&Server{}))
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/extract?fields=ip", "text/plain", strings.NewReader("2015-08-23 12:37:03 8.8.8.8 ok\nbroken\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testResponse(t, response, http.StatusOK, "8.8.8.8\n")
+
+	if !strings.Contains(response.Trailer.Get(extractErrorTrailer), "malformed log line") {
+		t.Errorf("Expected the error in the trailer but found %q", response.Trailer.Get(extractErrorTrailer))
+	}
+}
+
+func testResponse(t *testing.T, response *http.Response, status int, expected string) {
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.StatusCode != status {
+		t.Errorf("Expected status %d but found %s", status, response.Status)
+	}
+
+	if string(body) != expected {
+		t.Errorf("Expected\n---\n%s\n---\nbut found\n---\n%s\n---\n", expected, body)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type pooledFile struct {
+	name   string
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// Пул от отворени файлове с горна граница MaxOpen.
+// При препълване се затваря най-отдавна използваният файл,
+// а при следващ запис в него той се отваря отново за добавяне.
+type FilePool struct {
+	Dir     string
+	MaxOpen int
+	files   map[string]*list.Element
+	lru     *list.List
+	created map[string]bool
+}
+
+func NewFilePool(dir string, maxOpen int) *FilePool {
+	return &FilePool{
+		Dir:     dir,
+		MaxOpen: maxOpen,
+		files:   make(map[string]*list.Element),
+		lru:     list.New(),
+		created: make(map[string]bool),
+	}
+}
+
+func (p *FilePool) Writer(name string) (io.Writer, error) {
+	if element, isOpen := p.files[name]; isOpen {
+		p.lru.MoveToFront(element)
+		return element.Value.(*pooledFile).writer, nil
+	}
+
+	for p.lru.Len() >= p.MaxOpen && p.lru.Len() > 0 {
+		if err := p.closeOldest(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Файл от предишно пускане се презаписва, но след изгонване от пула
+	// трябва да продължим оттам, докъдето сме стигнали.
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+
+	if p.created[name] {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(filepath.Join(p.Dir, name), flags, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.created[name] = true
+	pooled := &pooledFile{name: name, file: file, writer: bufio.NewWriter(file)}
+	p.files[name] = p.lru.PushFront(pooled)
+
+	return pooled.writer, nil
+}
+
+func (p *FilePool) Close() error {
+	var errs []error
+
+	for p.lru.Len() > 0 {
+		errs = append(errs, p.closeOldest())
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *FilePool) closeOldest() error {
+	pooled := p.lru.Remove(p.lru.Back()).(*pooledFile)
+	delete(p.files, pooled.name)
+
+	err := pooled.writer.Flush()
+
+	return errors.Join(err, pooled.file.Close())
+}
+
+var partitioners = map[string]func(record *LogRecord, options *OutputOptions) string{
+	"ip": func(record *LogRecord, options *OutputOptions) string {
+		return record.IP
+	},
+	"hour": func(record *LogRecord, options *OutputOptions) string {
+		return record.Time.In(options.Location).Format("2006-01-02T15")
+	},
+	"day": func(record *LogRecord, options *OutputOptions) string {
+		return record.Time.In(options.Location).Format("2006-01-02")
+	},
+}
+
+// Превръща ключа на дяла в безопасно име на файл.
+func partitionFileName(key string) string {
+	key = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+
+		return r
+	}, key)
+
+	if key == "" || key == "." || key == ".." {
+		key = "_"
+	}
+
+	return key + ".log"
+}
+
+func runSplit(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("extract-column split", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	inputFlags := addInputFlags(flags)
+	outputFlags := addOutputFlags(flags)
+	by := flags.String("by", "ip", "partition key: ip, hour or day")
+	dir := flags.String("dir", "out", "directory to write the partitions to")
+	maxOpen := flags.Int("max-open", 64, "maximum number of simultaneously open partition files")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	partition, isKnown := partitioners[*by]
+
+	if !isKnown {
+		return fmt.Errorf("unknown partition key %q", *by)
+	}
+
+	if *maxOpen < 1 {
+		return fmt.Errorf("-max-open must be positive")
+	}
+
+	inputs, err := inputFlags.inputs(flags.Args())
+
+	if err != nil {
+		return err
+	}
+
+	options, err := outputFlags.options()
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+
+	pool := NewFilePool(*dir, *maxOpen)
+
+	err = ForEachRecord(inputs, stdin, func(record *LogRecord) error {
+		writer, err := pool.Writer(partitionFileName(partition(record, options)))
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(writer, options.FormatRecord(record))
+		return err
+	})
+
+	return errors.Join(err, pool.Close())
+}
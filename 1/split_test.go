@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSplitLogContents = `2015-08-23 12:37:03 8.8.8.8 first from Google
+2015-08-23 12:37:04 208.122.23.23 first from OpenDNS
+2015-08-23 13:01:00 8.8.4.4 only from Google
+2015-08-23 13:02:00 208.122.23.23 second from OpenDNS
+2015-08-23 13:03:00 8.8.8.8 second from Google
+`
+
+func TestSplitByIPWithSingleOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "8.8.8.8.log"), "stale contents from an earlier run\n")
+
+	testSplit(t, dir, "ip", "1", map[string]string{
+		"8.8.8.8.log":       "first from Google\nsecond from Google\n",
+		"8.8.4.4.log":       "only from Google\n",
+		"208.122.23.23.log": "first from OpenDNS\nsecond from OpenDNS\n",
+	})
+}
+
+func TestSplitByHour(t *testing.T) {
+	testSplit(t, t.TempDir(), "hour", "64", map[string]string{
+		"2015-08-23T12.log": "first from Google\nfirst from OpenDNS\n",
+		"2015-08-23T13.log": "only from Google\nsecond from OpenDNS\nsecond from Google\n",
+	})
+}
+
+func TestPartitionFileName(t *testing.T) {
+	for key, expected := range map[string]string{"10.0.0.1": "10.0.0.1.log", "../etc": ".._etc.log", "..": "_.log", "": "_.log"} {
+		if found := partitionFileName(key); found != expected {
+			t.Errorf("Expected %q for key %q but found %q", expected, key, found)
+		}
+	}
+}
+
+func testSplit(t *testing.T, dir, by, maxOpen string, expected map[string]string) {
+	args := []string{"split", "-by", by, "-dir", dir, "-max-open", maxOpen, "-fields", "message"}
+
+	if err := run(args, strings.NewReader(testSplitLogContents), io.Discard, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != len(expected) {
+		t.Errorf("Expected %d partitions but found %d", len(expected), len(entries))
+	}
+
+	for name, contents := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Errorf("Expected partition %s: %v", name, err)
+		} else if string(data) != contents {
+			t.Errorf("Expected %s to contain %q but found %q", name, contents, data)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+	ansiAlert = "\x1b[1;31m"
+)
+
+// Таблицата се изравнява на порции, за да не се държи целият изход
+// в паметта. Ширините на колоните само растат от порция към порция.
+const tableBatchSize = 256
+
+var ipColors = []string{"\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m", "\x1b[92m", "\x1b[93m", "\x1b[94m", "\x1b[95m", "\x1b[96m"}
+
+var alertKeywords = regexp.MustCompile(`(?i)\b(?:error|errors|fail|failed|failure|fatal|panic|exception|timeout|refused|denied)\b`)
+
+var wideRanges = []*unicode.RangeTable{
+	{R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1},
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1},
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1},
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1},
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1},
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1},
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1},
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1},
+		{Lo: 0xfe30, Hi: 0xfe4f, Stride: 1},
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1},
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1},
+	}},
+	{R32: []unicode.Range32{
+		{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1},
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1},
+		{Lo: 0x20000, Hi: 0x2fffd, Stride: 1},
+		{Lo: 0x30000, Hi: 0x3fffd, Stride: 1},
+	}},
+}
+
+// Колко клетки заема низът в терминала: широките (източноазиатски,
+// емоджи) символи са по две, а комбиниращите и управляващите - нула.
+func displayWidth(s string) int {
+	width := 0
+
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) || unicode.IsControl(r):
+		case unicode.In(r, wideRanges...):
+			width += 2
+		default:
+			width++
+		}
+	}
+
+	return width
+}
+
+// Дали w е терминал. Изходът към файл или програма остава в обикновения формат.
+func isTerminal(w io.Writer) bool {
+	file, isFile := w.(*os.File)
+
+	if !isFile {
+		return false
+	}
+
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type TableWriter struct {
+	Color  bool
+	writer io.Writer
+	fields []string
+	widths []int
+	rows   [][]string
+}
+
+func NewTableWriter(writer io.Writer, fields []string, color bool) *TableWriter {
+	return &TableWriter{
+		Color:  color,
+		writer: writer,
+		fields: fields,
+		widths: make([]int, len(fields)),
+	}
+}
+
+func (t *TableWriter) Add(values []string) {
+	t.rows = append(t.rows, values)
+
+	if len(t.rows) >= tableBatchSize {
+		t.Flush()
+	}
+}
+
+func (t *TableWriter) Flush() {
+	for _, row := range t.rows {
+		for i, value := range row {
+			t.widths[i] = max(t.widths[i], displayWidth(value))
+		}
+	}
+
+	for _, row := range t.rows {
+		var line strings.Builder
+
+		for i, value := range row {
+			if i > 0 {
+				line.WriteString("  ")
+			}
+
+			line.WriteString(t.colorize(t.fields[i], value))
+
+			// Последната колона не се допълва, за да няма интервали в края на реда.
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", t.widths[i]-displayWidth(value)))
+			}
+		}
+
+		fmt.Fprintln(t.writer, line.String())
+	}
+
+	t.rows = t.rows[:0]
+}
+
+func (t *TableWriter) colorize(field, value string) string {
+	if !t.Color || value == "" {
+		return value
+	}
+
+	switch field {
+	case "time":
+		return ansiDim + value + ansiReset
+	case "ip":
+		hash := fnv.New32a()
+		hash.Write([]byte(value))
+		return ipColors[hash.Sum32()%uint32(len(ipColors))] + value + ansiReset
+	case "message":
+		return alertKeywords.ReplaceAllStringFunc(value, func(keyword string) string {
+			return ansiAlert + keyword + ansiReset
+		})
+	}
+
+	return value
+}
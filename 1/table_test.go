@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	for s, expected := range map[string]int{
+		"8.8.8.8":   7,
+		"Здравей":   7,
+		"日本語":       6,
+		"e\u0301":   1,
+		"ok 👍":      5,
+		"tab\there": 7,
+	} {
+		if found := displayWidth(s); found != expected {
+			t.Errorf("Expected width %d for %q but found %d", expected, s, found)
+		}
+	}
+}
+
+func TestTableAlignsWideCharacters(t *testing.T) {
+	logContents := `2015-08-23 12:37:03 8.8.8.8 日本語 works
+2015-08-23 12:37:04 208.122.23.23 plain
+`
+
+	expected := `2015-08-23 12:37:03  8.8.8.8        日本語 works
+2015-08-23 12:37:04  208.122.23.23  plain
+`
+
+	testRun(t, expected, logContents, "-table", "always", "-color", "never")
+}
+
+func TestTableColors(t *testing.T) {
+	var stdout bytes.Buffer
+	logContents := "2015-08-23 12:37:03 8.8.8.8 connection refused by peer\n"
+
+	if err := run([]string{"-table", "always", "-color", "always"}, strings.NewReader(logContents), &stdout, &stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	found := stdout.String()
+
+	for _, expected := range []string{ansiDim + "2015-08-23 12:37:03" + ansiReset, ansiAlert + "refused" + ansiReset, "8.8.8.8" + ansiReset} {
+		if !strings.Contains(found, expected) {
+			t.Errorf("Expected %q in %q", expected, found)
+		}
+	}
+}
+
+func TestPipedOutputStaysPlain(t *testing.T) {
+	testRun(t, testLogContents, testLogContents)
+
+	if err := run([]string{"-table", "sometimes"}, strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an invalid -table value to be rejected")
+	}
+}
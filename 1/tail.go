@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+const reverseBlockSize = 64 * 1024
+
+// Чете редовете на файл отзад напред, на блокове от края му,
+// така че последните редове на голям лог се четат без да се обхожда целият.
+type ReverseScanner struct {
+	reader    io.ReaderAt
+	offset    int64
+	pending   []byte
+	line      string
+	blockSize int
+	done      bool
+	err       error
+}
+
+func NewReverseScanner(reader io.ReaderAt, size int64) *ReverseScanner {
+	return &ReverseScanner{reader: reader, offset: size, blockSize: reverseBlockSize}
+}
+
+func (s *ReverseScanner) Scan() bool {
+	for !s.done {
+		if i := bytes.LastIndexByte(s.pending, '\n'); i >= 0 {
+			s.line = string(s.pending[i+1:])
+			s.pending = s.pending[:i]
+			return true
+		}
+
+		if s.offset == 0 {
+			s.line = string(s.pending)
+			s.pending = nil
+			s.done = true
+			return true
+		}
+
+		n := int64(s.blockSize)
+
+		if n > s.offset {
+			n = s.offset
+		}
+
+		s.offset -= n
+		block := make([]byte, n, n+int64(len(s.pending)))
+
+		if _, err := s.reader.ReadAt(block, s.offset); err != nil && err != io.EOF {
+			s.err = err
+			s.done = true
+			return false
+		}
+
+		s.pending = append(block, s.pending...)
+	}
+
+	return false
+}
+
+func (s *ReverseScanner) Text() string {
+	return s.line
+}
+
+func (s *ReverseScanner) Err() error {
+	return s.err
+}
+
+// Връща до limit последни записа, за които keep е вярно, от най-новия към
+// най-стария; limit == 0 значи всички. Един файл се чете отзад напред и
+// четенето спира щом се съберат достатъчно записи. Стандартният вход и
+// няколко входа се четат напред, като се пазят само последните limit записа.
+func LastRecords(inputs []*Input, stdin io.Reader, keep func(*LogRecord) bool, limit int) ([]*LogRecord, error) {
+	if len(inputs) == 1 && inputs[0].Path != "-" {
+		return lastRecordsOfFile(inputs[0], keep, limit)
+	}
+
+	var records []*LogRecord
+
+	err := ForEachRecord(inputs, stdin, func(record *LogRecord) error {
+		if !keep(record) {
+			return nil
+		}
+
+		records = append(records, record)
+
+		if limit > 0 && len(records) > 2*limit {
+			records = append(records[:0], records[len(records)-limit:]...)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records, nil
+}
+
+func lastRecordsOfFile(input *Input, keep func(*LogRecord) bool, limit int) ([]*LogRecord, error) {
+	file, err := os.Open(input.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return LastRecords([]*Input{{Path: "-", Location: input.Location}}, file, keep, limit)
+	}
+
+	var records []*LogRecord
+	scanner := NewReverseScanner(file, info.Size())
+
+	for (limit == 0 || len(records) < limit) && scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			continue
+		}
+
+		record, err := ParseLogRecord(line, input.Location)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", input.Path, err)
+		}
+
+		if keep(record) {
+			records = append(records, record)
+		}
+	}
+
+	return records, scanner.Err()
+}
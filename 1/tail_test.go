@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type countingReaderAt struct {
+	reader io.ReaderAt
+	read   int
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	n, err := r.reader.ReadAt(p, offset)
+	r.read += n
+	return n, err
+}
+
+func TestReverseScanner(t *testing.T) {
+	for _, contents := range []string{"first\nsecond\nthird\n", "first\nsecond\nthird", "\nfirst\n\nsecond\nthird"} {
+		scanner := NewReverseScanner(strings.NewReader(contents), int64(len(contents)))
+		scanner.blockSize = 4
+
+		var found []string
+
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				found = append(found, line)
+			}
+		}
+
+		if scanner.Err() != nil {
+			t.Fatal(scanner.Err())
+		}
+
+		if expected := []string{"third", "second", "first"}; !reflect.DeepEqual(found, expected) {
+			t.Errorf("Expected %q for %q but found %q", expected, contents, found)
+		}
+	}
+}
+
+func TestReverseScannerReadsOnlyTheEnd(t *testing.T) {
+	var log strings.Builder
+
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&log, "2015-08-23 12:37:03 10.0.0.1 line %d\n", i)
+	}
+
+	reader := &countingReaderAt{reader: strings.NewReader(log.String())}
+	scanner := NewReverseScanner(reader, int64(log.Len()))
+	scanner.blockSize = 1024
+
+	for i := 0; i < 3 && scanner.Scan(); i++ {
+	}
+
+	if scanner.Text() != "2015-08-23 12:37:03 10.0.0.1 line 9998" {
+		t.Errorf("Expected the third line from the end but found %q", scanner.Text())
+	}
+
+	if reader.read > 1024 {
+		t.Errorf("Expected a single block to be read but found %d bytes", reader.read)
+	}
+}
+
+const testTailLogContents = `2015-08-23 12:37:01 10.0.0.1 one
+2015-08-23 12:37:02 8.8.8.8 two
+2015-08-23 12:37:03 10.0.0.2 three
+2015-08-23 12:37:04 8.8.4.4 four
+2015-08-23 12:37:05 10.1.0.1 five
+2015-08-23 12:37:06 8.8.8.8 six
+`
+
+func TestTailAndReverse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.log")
+	writeTestFile(t, path, testTailLogContents)
+
+	for _, input := range []string{path, "-"} {
+		testRun(t, "three\nfive\n", testTailLogContents, "-fields", "message", "-tail", "2", "-ip", "10.0.0.0/8", input)
+		testRun(t, "five\nthree\n", testTailLogContents, "-fields", "message", "-tail", "2", "-ip", "10.0.0.0/8", "-reverse", input)
+		testRun(t, "six\nfive\nfour\nthree\ntwo\none\n", testTailLogContents, "-fields", "message", "-reverse", input)
+		testRun(t, testTailLogContents, testTailLogContents, "-tail", "100", input)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TimeFormatDefault = ""
+	TimeFormatRFC3339 = "rfc3339"
+	TimeFormatUnix    = "unix"
+)
+
+// Зарежда часова зона по IANA име ("Europe/Sofia"), "UTC", "Local"
+// или фиксирано отместване ("+02:00", "-0500").
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		offset, err := parseOffset(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return time.FixedZone(name, offset), nil
+	}
+
+	return time.LoadLocation(name)
+}
+
+func parseOffset(name string) (int, error) {
+	for _, layout := range []string{"-07:00", "-0700", "-07"} {
+		t, err := time.Parse(layout, name)
+
+		if err == nil {
+			_, offset := t.Zone()
+			return offset, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown time zone offset %q", name)
+}
+
+// Форматира времето като RFC 3339, Unix epoch или по произволен layout.
+// По подразбиране се използва форматът на самия лог.
+func FormatTime(t time.Time, format string) string {
+	switch format {
+	case TimeFormatDefault:
+		return t.Format(logTimeLayout)
+	case TimeFormatRFC3339:
+		return t.Format(time.RFC3339)
+	case TimeFormatUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	default:
+		return t.Format(format)
+	}
+}
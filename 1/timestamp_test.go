@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLogContents = `2015-08-23 12:37:03 8.8.8.8 As far as we can tell this is a DNS
+2015-08-23 12:37:04 8.8.4.4 Yet another DNS, how quaint!
+2015-08-23 12:37:05 208.122.23.23 There is definitely some trend here
+`
+
+func TestLoadLocationOffsets(t *testing.T) {
+	for name, expected := range map[string]int{"+02:00": 7200, "-0500": -18000, "+03": 10800} {
+		location, err := LoadLocation(name)
+
+		if err != nil {
+			t.Fatalf("LoadLocation(%q) failed: %v", name, err)
+		}
+
+		_, offset := time.Date(2015, 8, 23, 0, 0, 0, 0, location).Zone()
+
+		if offset != expected {
+			t.Errorf("Expected offset %d for %q but found %d", expected, name, offset)
+		}
+	}
+
+	if _, err := LoadLocation("+25:99"); err == nil {
+		t.Errorf("Expected an error for an invalid offset")
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	moment := time.Date(2015, 8, 23, 12, 37, 3, 0, time.UTC)
+
+	for format, expected := range map[string]string{
+		TimeFormatDefault:  "2015-08-23 12:37:03",
+		TimeFormatRFC3339:  "2015-08-23T12:37:03Z",
+		TimeFormatUnix:     "1440333423",
+		"02.01.2006 15:04": "23.08.2015 12:37",
+	} {
+		if found := FormatTime(moment, format); found != expected {
+			t.Errorf("Expected %q for format %q but found %q", expected, format, found)
+		}
+	}
+}
+
+func TestDefaultExtractCopiesLogVerbatim(t *testing.T) {
+	testRun(t, testLogContents, testLogContents)
+}
+
+func TestConvertToTargetZone(t *testing.T) {
+	expected := `2015-08-23T15:37:03+03:00 8.8.8.8
+2015-08-23T15:37:04+03:00 8.8.4.4
+2015-08-23T15:37:05+03:00 208.122.23.23
+`
+
+	testRun(t, expected, testLogContents, "-tz", "+03:00", "-time-format", "rfc3339", "-fields", "time,ip")
+}
+
+func TestMergeInputsFromDifferentZones(t *testing.T) {
+	dir := t.TempDir()
+	sofia := filepath.Join(dir, "sofia.log")
+	london := filepath.Join(dir, "london.log")
+
+	writeTestFile(t, sofia, `2015-08-23 15:00:00 10.0.0.1 first in Sofia
+2015-08-23 15:30:00 10.0.0.1 second in Sofia
+`)
+	writeTestFile(t, london, `2015-08-23 12:15:00 10.0.0.2 first in London
+2015-08-23 12:45:00 10.0.0.2 second in London
+`)
+
+	expected := `1440331200 first in Sofia
+1440332100 first in London
+1440333000 second in Sofia
+1440333900 second in London
+`
+
+	testRun(t, expected, "", "-time-format", "unix", "-fields", "time,message", sofia+"@+03:00", london+"@+00:00")
+}
+
+func TestInputPathWithAt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "user@host.log")
+	writeTestFile(t, path, testLogContents)
+
+	testRun(t, testLogContents, "", path)
+	testRun(t, "1440333423\n1440333424\n1440333425\n", "", "-time-format", "unix", "-fields", "time", path+"@+00:00")
+
+	if _, err := ParseInput(filepath.Join(filepath.Dir(path), "missing@host.log"), time.UTC); err == nil {
+		t.Error("Expected an unknown zone to be reported for a missing file")
+	}
+}
+
+// Поток, който след данните си връща грешка вместо EOF.
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestForEachRecordStreamsMergedInputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "first.log")
+	writeTestFile(t, path, testLogContents)
+
+	inputs := []*Input{{Path: path, Location: time.UTC}, {Path: "-", Location: time.UTC}}
+	stdin := &failingReader{"2015-08-23 12:37:04 10.0.0.1 from stdin\n", errors.New("connection reset")}
+
+	var messages []string
+
+	stop := errors.New("stop")
+	err := ForEachRecord(inputs, stdin, func(record *LogRecord) error {
+		messages = append(messages, record.Message)
+
+		if len(messages) == 3 {
+			return stop
+		}
+
+		return nil
+	})
+
+	// Записите излизат, преди входовете да са прочетени докрай.
+	if err != stop {
+		t.Errorf("Expected the handler's error but found %v", err)
+	}
+
+	expected := []string{"As far as we can tell this is a DNS", "Yet another DNS, how quaint!", "from stdin"}
+
+	if strings.Join(messages, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q but found %q", expected, messages)
+	}
+
+	_, err = ReadRecords(inputs, &failingReader{"", errors.New("connection reset")})
+
+	if err == nil || err.Error() != "-: connection reset" {
+		t.Errorf("Expected the read error of stdin but found %v", err)
+	}
+}
+
+func testRun(t *testing.T, expected, stdin string, args ...string) {
+	var stdout bytes.Buffer
+
+	if err := run(args, strings.NewReader(stdin), &stdout, io.Discard); err != nil {
+		t.Fatalf("run(%q) failed: %v", args, err)
+	}
+
+	if found := stdout.String(); found != expected {
+		t.Errorf("Expected\n---\n%s\n---\nbut found\n---\n%s\n---\n", expected, found)
+	}
+}
+
+func writeTestFile(t *testing.T, path, contents string) {
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
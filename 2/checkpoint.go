@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Записаното в CheckpointStore: колко записа от всеки източник (по име)
+// вече са обработени и докъде е стигнало подреждането.
+type Checkpoint struct {
+	// Общият брой обработени записи.
+	Position int `json:"position"`
+	// Името на източника на последния обработен запис.
+	Source string `json:"source,omitempty"`
+	// За всеки източник: колко записа от началото му са обработени или
+	// пропуснати (LateDrop) без пропуск помежду им.
+	Offsets map[string]int `json:"offsets"`
+}
+
+// Пази Checkpoint във файл. Потребителят на изхода извиква Commit за
+// всеки обработен запис; при рестарт Drainer с Checkpoint отваря
+// източниците с Reopen от записаните отмествания, затова нищо не се
+// губи. При сливане по време записите на източника може да излязат
+// разбъркано; тогава отместването стига само до първия необработен
+// запис и обработените след него се повтарят след рестарт.
+// nil *CheckpointStore не пази нищо.
+type CheckpointStore struct {
+	// През колко Commit файлът се записва наново. Всеки запис е нов
+	// файл, fsync и преименуване, затова при много записи има смисъл
+	// да е повече от 1; тогава след срив до SaveEvery-1 записа се
+	// повтарят (но не се губят). Нула означава 1. Save записва
+	// незаписаното веднага.
+	SaveEvery int
+
+	path       string
+	mutex      sync.Mutex
+	checkpoint Checkpoint
+	unsaved    int
+	// Обработените след отместването записи на всеки източник (по
+	// отместването след тях), които чакат по-ранните.
+	ahead map[string]map[int]bool
+}
+
+// Отваря хранилище във файла path, като зарежда записаното в него,
+// ако файлът вече съществува.
+func OpenCheckpointStore(path string) (*CheckpointStore, error) {
+	store := &CheckpointStore{path: path, checkpoint: Checkpoint{Offsets: map[string]int{}}, ahead: map[string]map[int]bool{}}
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &store.checkpoint); err != nil {
+		return nil, err
+	}
+
+	if store.checkpoint.Offsets == nil {
+		store.checkpoint.Offsets = map[string]int{}
+	}
+
+	return store, nil
+}
+
+// Колко записа от източника name вече са обработени.
+func (s *CheckpointStore) Offset(name string) int {
+	if s == nil {
+		return 0
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.checkpoint.Offsets[name]
+}
+
+// Копие на текущото състояние.
+func (s *CheckpointStore) Checkpoint() Checkpoint {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	checkpoint := s.checkpoint
+	checkpoint.Offsets = make(map[string]int, len(s.checkpoint.Offsets))
+
+	for name, offset := range s.checkpoint.Offsets {
+		checkpoint.Offsets[name] = offset
+	}
+
+	return checkpoint
+}
+
+// Отбелязва entry като обработен и според SaveEvery записва
+// състоянието на диска. Служебните записи (с Marker) не се броят.
+func Commit[T any](s *CheckpointStore, entry Entry[T]) error {
+	if s == nil || entry.Marker != NoMarker {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.checkpoint.Position++
+	s.checkpoint.Source = entry.Name
+	return s.advance(entry.Name, entry.end)
+}
+
+// Отбелязва пропуснатия от Drainer запис, който завършва на end в
+// източника name, така че отместването да може да го подмине.
+func (s *CheckpointStore) skip(name string, end int) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.advance(name, end)
+}
+
+// Придвижва отместването на name през записа, завършващ на end (нула
+// означава следващия), и през чакащите след него.
+func (s *CheckpointStore) advance(name string, end int) error {
+	offset := s.checkpoint.Offsets[name]
+
+	switch {
+	case end == 0 || end == offset+1:
+		offset++
+
+		for s.ahead[name][offset+1] {
+			delete(s.ahead[name], offset+1)
+			offset++
+		}
+
+		s.checkpoint.Offsets[name] = offset
+	case end > offset:
+		if s.ahead[name] == nil {
+			s.ahead[name] = map[int]bool{}
+		}
+
+		s.ahead[name][end] = true
+	}
+
+	s.unsaved++
+
+	if s.unsaved < max(s.SaveEvery, 1) {
+		return nil
+	}
+
+	return s.save()
+}
+
+// Записва на диска всички досега отбелязани записи.
+func (s *CheckpointStore) Save() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.unsaved == 0 {
+		return nil
+	}
+
+	return s.save()
+}
+
+// Файлът се подменя атомарно и се синхронизира с диска заедно с
+// директорията си, така че срив по време на запис не го поврежда.
+func (s *CheckpointStore) save() error {
+	data, err := json.Marshal(s.checkpoint)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.unsaved = 0
+	return syncDir(filepath.Dir(s.path))
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Източник с име name, който чете редовете на файла path до края му и
+// може да бъде отворен наново от произволен ред нататък. Дължината на
+// редовете не е ограничена, а грешка при четене прекратява изпразването.
+func FileSource(name, path string) *Source[string] {
+	return &Source[string]{
+		Name: name,
+		Reopen: func(ctx context.Context, offset int, fail func(error)) (chan string, error) {
+			file, err := os.Open(path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			lines := make(chan string)
+
+			go func() {
+				defer file.Close()
+
+				reader := bufio.NewReader(file)
+
+				for i := 0; ; i++ {
+					line, err := reader.ReadString('\n')
+
+					if err != nil && !errors.Is(err, io.EOF) {
+						// Без затваряне на lines, за да не изглежда
+						// източникът изчерпан преди грешката да стигне.
+						fail(err)
+						return
+					}
+
+					if line == "" {
+						close(lines)
+						return
+					}
+
+					if i < offset {
+						continue
+					}
+
+					select {
+					case lines <- strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			return lines, nil
+		},
+	}
+}
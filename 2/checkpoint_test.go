@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckpointStoreSurvivesReopening(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	store, err := OpenCheckpointStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []Entry[string]{
+		{Source: 1, Name: "a", Value: "x"},
+		{Source: 1, Name: "a", Marker: GapMarker},
+		{Source: 1, Name: "a", Value: "y"},
+		{Source: 2, Name: "b", Value: "z"},
+	} {
+		if err := Commit(store, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenCheckpointStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Checkpoint{Position: 3, Source: "b", Offsets: map[string]int{"a": 2, "b": 1}}
+
+	if found := reopened.Checkpoint(); !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %+v but found %+v", expected, found)
+	}
+}
+
+// Изпразва файловете в dir, докато не се обработят limit записа
+// (или всички при limit < 0), и връща обработените.
+func testDrainFiles(t *testing.T, dir string, limit int) []string {
+	store, err := OpenCheckpointStore(filepath.Join(dir, "checkpoint.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sources := make(chan *Source[string], 2)
+	sources <- FileSource("a", filepath.Join(dir, "a.log"))
+	sources <- FileSource("b", filepath.Join(dir, "b.log"))
+	close(sources)
+
+	entries, _ := (&Drainer[string]{Checkpoint: store}).DrainSources(ctx, sources)
+
+	var processed []string
+
+	for entry := range entries {
+		if len(processed) == limit {
+			break
+		}
+
+		processed = append(processed, FormatSourceEntry(entry))
+
+		if err := Commit(store, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return processed
+}
+
+func TestResumeFromCheckpointWithoutDuplicatesOrGaps(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.log"), []byte("a1\na2\na3\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.log"), []byte("b1\nb2\n"), 0644)
+
+	// Първото изпразване "пада" след четвъртия запис.
+	found := testDrainFiles(t, dir, 4)
+	found = append(found, testDrainFiles(t, dir, -1)...)
+
+	expected := []string{"a\ta1", "a\ta2", "a\ta3", "b\tb1", "b\tb2"}
+
+	if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected\n%s\nbut found\n%s", strings.Join(expected, "\n"), strings.Join(found, "\n"))
+	}
+
+	if rest := testDrainFiles(t, dir, -1); len(rest) != 0 {
+		t.Errorf("Expected nothing after everything was processed but found %v", rest)
+	}
+}
+
+// Като testDrainFiles, но за един файл, чиито редове са секунди и се
+// сливат по време с d.
+func testDrainFileByTime(t *testing.T, dir string, d *Drainer[string], limit int) []string {
+	store, err := OpenCheckpointStore(filepath.Join(dir, "checkpoint.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sources := make(chan *Source[string], 1)
+	sources <- FileSource("a", filepath.Join(dir, "a.log"))
+	close(sources)
+
+	d.Checkpoint = store
+	d.Timestamp = func(line string) time.Time {
+		seconds, _ := strconv.Atoi(line)
+		return time.Unix(int64(seconds), 0)
+	}
+
+	entries, _ := d.DrainSources(ctx, sources)
+
+	var processed []string
+
+	for entry := range entries {
+		if len(processed) == limit {
+			break
+		}
+
+		processed = append(processed, entry.Value)
+
+		if err := Commit(store, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return processed
+}
+
+func TestResumeFromCheckpointByTime(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.log"), []byte("5\n3\n9\n"), 0644)
+
+	// "3" излиза първи, но отместването не бива да прескочи "5".
+	found := testDrainFileByTime(t, dir, &Drainer[string]{AllowedLateness: 10 * time.Second}, 1)
+	found = append(found, testDrainFileByTime(t, dir, &Drainer[string]{AllowedLateness: 10 * time.Second}, -1)...)
+
+	if expected := "3 3 5 9"; strings.Join(found, " ") != expected {
+		t.Errorf("Expected %q but found %q", expected, strings.Join(found, " "))
+	}
+
+	if rest := testDrainFileByTime(t, dir, &Drainer[string]{}, -1); len(rest) != 0 {
+		t.Errorf("Expected nothing after everything was processed but found %v", rest)
+	}
+}
+
+func TestResumeFromCheckpointPastDroppedEntries(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.log"), []byte("5\n20\n3\n30\n"), 0644)
+
+	// "3" закъснява и се пропуска, но не задържа отместването.
+	found := testDrainFileByTime(t, dir, &Drainer[string]{Late: LateDrop}, -1)
+
+	if expected := "5 20 30"; strings.Join(found, " ") != expected {
+		t.Errorf("Expected %q but found %q", expected, strings.Join(found, " "))
+	}
+
+	if rest := testDrainFileByTime(t, dir, &Drainer[string]{Late: LateDrop}, -1); len(rest) != 0 {
+		t.Errorf("Expected nothing after everything was processed but found %v", rest)
+	}
+}
+
+func TestReopenErrorEndsTheDrain(t *testing.T) {
+	sources := make(chan *Source[string], 1)
+	sources <- FileSource("missing", filepath.Join(t.TempDir(), "missing.log"))
+	close(sources)
+
+	entries, done := (&Drainer[string]{}).DrainSources(context.Background(), sources)
+
+	for range entries {
+	}
+
+	if err := <-done; !os.IsNotExist(err) {
+		t.Errorf("Expected the missing file to be reported but found %v", err)
+	}
+}
+
+func TestFileSourceReadsLongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "long.log")
+	long := strings.Repeat("x", 100*1024)
+	os.WriteFile(path, []byte("first\n"+long+"\r\nlast"), 0644)
+
+	sources := make(chan *Source[string], 1)
+	sources <- FileSource("long", path)
+	close(sources)
+
+	entries, done := (&Drainer[string]{}).DrainSources(context.Background(), sources)
+
+	var found []string
+
+	for entry := range entries {
+		found = append(found, entry.Value)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 3 || found[0] != "first" || found[1] != long || found[2] != "last" {
+		t.Errorf("Expected the long line between the other two but found %d lines", len(found))
+	}
+}
+
+func TestFileSourceReadErrorEndsTheDrain(t *testing.T) {
+	sources := make(chan *Source[string], 1)
+	sources <- FileSource("directory", t.TempDir())
+	close(sources)
+
+	entries, done := (&Drainer[string]{}).DrainSources(context.Background(), sources)
+
+	for range entries {
+	}
+
+	if err := <-done; err == nil {
+		t.Error("Expected the read error to end the drain")
+	}
+}
+
+func TestCheckpointStoreSavesInBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	store, err := OpenCheckpointStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.SaveEvery = 3
+
+	for i := 0; i < 4; i++ {
+		if err := Commit(store, Entry[string]{Source: 1, Name: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testSavedOffset := func(expected int) {
+		reopened, err := OpenCheckpointStore(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if offset := reopened.Offset("a"); offset != expected {
+			t.Errorf("Expected %d saved entries but found %d", expected, offset)
+		}
+	}
+
+	testSavedOffset(3)
+
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	testSavedOffset(4)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const commandSeparator = ":::"
+
+// Колко реда изход на командите, чакащи реда си, се държат в паметта по
+// подразбиране, преди да се изливат на диска.
+const defaultCommandMemoryBudget = 10000
+
+// Част от изхода на команда: ред (заедно с новия ред, ако има такъв)
+// от стандартния ѝ изход или от стандартната ѝ грешка.
+type CommandOutput struct {
+	Stderr bool
+	Text   string
+}
+
+// Разделя "[--] cmd1 args ::: cmd2 args ..." на отделни команди.
+func parseCommands(args []string) ([][]string, error) {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("usage: ordered-drain [-memory-budget N] [-spill-dir DIR] -- cmd1 [args] ::: cmd2 [args] ...")
+	}
+
+	var (
+		commands [][]string
+		command  []string
+	)
+
+	for _, arg := range append(args, commandSeparator) {
+		if arg != commandSeparator {
+			command = append(command, arg)
+			continue
+		}
+
+		if len(command) == 0 {
+			return nil, fmt.Errorf("empty command in %q", strings.Join(args, " "))
+		}
+
+		commands = append(commands, command)
+		command = nil
+	}
+
+	return commands, nil
+}
+
+// Пуска команда и връща източник с изхода ѝ. status получава резултата
+// от изпълнението, преди източникът да бъде затворен и finished да
+// бъде отбелязан. При прекратяване на ctx командата се убива.
+func startCommand(ctx context.Context, args []string, status *error, finished *sync.WaitGroup) *Source[CommandOutput] {
+	output := make(chan CommandOutput)
+	source := &Source[CommandOutput]{Name: strings.Join(args, " "), Entries: output}
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	stdout, stderr, err := startWithPipes(command)
+
+	if err != nil {
+		*status = err
+		close(output)
+		return source
+	}
+
+	finished.Add(1)
+
+	go func() {
+		defer finished.Done()
+		defer close(output)
+
+		var wait sync.WaitGroup
+		wait.Add(2)
+
+		go readOutput(ctx, stdout, false, output, &wait)
+		go readOutput(ctx, stderr, true, output, &wait)
+
+		// Wait затваря тръбите, затова се вика едва след като са прочетени.
+		wait.Wait()
+		*status = command.Wait()
+	}()
+
+	return source
+}
+
+func startWithPipes(command *exec.Cmd) (io.Reader, io.Reader, error) {
+	stdout, err := command.StdoutPipe()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stderr, err := command.StderrPipe()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return stdout, stderr, command.Start()
+}
+
+func readOutput(ctx context.Context, pipe io.Reader, isStderr bool, output chan<- CommandOutput, wait *sync.WaitGroup) {
+	defer wait.Done()
+
+	reader := bufio.NewReader(pipe)
+
+	for {
+		text, err := reader.ReadString('\n')
+
+		if text != "" {
+			select {
+			case output <- CommandOutput{isStderr, text}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Пуска командите едновременно и извежда изхода на всяка от тях
+// наведнъж, в реда на аргументите, като parallel --keep-order.
+// Накрая в stderr излиза изходният статус на всяка команда. Изходът,
+// който чака по-ранните команди, се излива на диска над -memory-budget реда.
+func runCommands(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("ordered-drain", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	memoryBudget := flags.Int("memory-budget", defaultCommandMemoryBudget, "how many lines of waiting output to keep in memory before spilling to disk (0 for no limit)")
+	spillDir := flags.String("spill-dir", "", "directory for the spilled output (default the system temporary directory)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *memoryBudget < 0 {
+		return errors.New("-memory-budget must not be negative")
+	}
+
+	commands, err := parseCommands(flags.Args())
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	statuses := make([]error, len(commands))
+	sources := make(chan *Source[CommandOutput], len(commands))
+
+	var finished sync.WaitGroup
+
+	for i, command := range commands {
+		sources <- startCommand(ctx, command, &statuses[i], &finished)
+	}
+
+	close(sources)
+
+	drainer := &Drainer[CommandOutput]{MemoryBudget: *memoryBudget, SpillDir: *spillDir}
+	entries, done := drainer.DrainSources(ctx, sources)
+	err = writeCommandOutput(entries, stdout, stderr)
+
+	// Ако писането или изпразването се провали, недовършените команди
+	// се убиват, но статусите на всички пак излизат.
+	if err != nil {
+		cancel()
+	}
+
+	if drainErr := <-done; err == nil {
+		err = drainErr
+	}
+
+	if err != nil {
+		cancel()
+	}
+
+	finished.Wait()
+
+	failed := 0
+
+	for i, status := range statuses {
+		result := "exit status 0"
+
+		if status != nil {
+			failed++
+			result = status.Error()
+		}
+
+		fmt.Fprintf(stderr, "%d\t%s\t%s\n", i+1, strings.Join(commands[i], " "), result)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d commands failed", failed, len(commands))
+	}
+
+	return nil
+}
+
+// Извежда изхода на командите в stdout и stderr, докато entries не
+// се затвори или писането не се провали.
+func writeCommandOutput(entries <-chan Entry[CommandOutput], stdout, stderr io.Writer) error {
+	for entry := range entries {
+		out := stdout
+
+		if entry.Value.Stderr {
+			out = stderr
+		}
+
+		if _, err := io.WriteString(out, entry.Value.Text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
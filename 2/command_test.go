@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommands(t *testing.T) {
+	commands, err := parseCommands(strings.Fields("-- echo a ::: ls -l /tmp ::: true"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(commands) != 3 || strings.Join(commands[1], " ") != "ls -l /tmp" {
+		t.Errorf("Expected three commands but found %q", commands)
+	}
+
+	for _, args := range []string{"--", "-- echo a :::", "-- ::: echo a", "echo a ::: ::: echo b"} {
+		if _, err := parseCommands(strings.Fields(args)); err == nil {
+			t.Errorf("Expected %q to be rejected", args)
+		}
+	}
+}
+
+func TestRunCommandsKeepsOutputInArgumentOrder(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	err := runCommands([]string{
+		"--", "sh", "-c", "sleep 0.1; echo a1; echo a2",
+		":::", "sh", "-c", "echo b1; echo b2 >&2; printf b3; exit 3",
+		":::", "echo", "c1",
+	}, &stdout, &stderr)
+
+	if err == nil || err.Error() != "1 of 3 commands failed" {
+		t.Errorf("Expected one failed command but found %v", err)
+	}
+
+	if expected := "a1\na2\nb1\nb3c1\n"; stdout.String() != expected {
+		t.Errorf("Expected stdout %q but found %q", expected, stdout.String())
+	}
+
+	expected := "b2\n" +
+		"1\tsh -c sleep 0.1; echo a1; echo a2\texit status 0\n" +
+		"2\tsh -c echo b1; echo b2 >&2; printf b3; exit 3\texit status 3\n" +
+		"3\techo c1\texit status 0\n"
+
+	if stderr.String() != expected {
+		t.Errorf("Expected stderr %q but found %q", expected, stderr.String())
+	}
+}
+
+func TestRunCommandsReportsMissingExecutable(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	if err := runCommands([]string{"--", "./does-not-exist", ":::", "echo", "ok"}, &stdout, &stderr); err == nil {
+		t.Error("Expected the missing executable to fail the run")
+	}
+
+	if stdout.String() != "ok\n" {
+		t.Errorf("Expected the other command's output but found %q", stdout.String())
+	}
+
+	if !strings.HasPrefix(stderr.String(), "1\t./does-not-exist\t") || !strings.Contains(stderr.String(), "2\techo ok\texit status 0\n") {
+		t.Errorf("Expected both statuses but found %q", stderr.String())
+	}
+}
+
+func TestRunCommandsSpillsWaitingOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	err := runCommands([]string{
+		"-memory-budget", "2", "-spill-dir", t.TempDir(),
+		"--", "sh", "-c", "sleep 0.1; echo a",
+		":::", "seq", "5",
+	}, &stdout, &stderr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "a\n1\n2\n3\n4\n5\n"; stdout.String() != expected {
+		t.Errorf("Expected stdout %q but found %q", expected, stdout.String())
+	}
+
+	// Изливането в несъществуваща директория проваля изпразването.
+	err = runCommands([]string{
+		"-memory-budget", "2", "-spill-dir", t.TempDir() + "/missing",
+		"--", "sh", "-c", "sleep 0.1; echo a",
+		":::", "seq", "5",
+	}, &stdout, &stderr)
+
+	if err == nil {
+		t.Error("Expected the missing spill directory to fail the run")
+	}
+
+	if err := runCommands([]string{"-memory-budget", "-1", "--", "true"}, &stdout, &stderr); err == nil {
+		t.Error("Expected a negative memory budget to be rejected")
+	}
+}
+
+func TestRunCommandsReportsStatusesWhenTheDrainFails(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	start := time.Now()
+	err := runCommands([]string{
+		"-memory-budget", "2", "-spill-dir", t.TempDir() + "/missing",
+		"--", "sleep", "10",
+		":::", "seq", "5",
+	}, &stdout, &stderr)
+
+	if err == nil || strings.Contains(err.Error(), "commands failed") {
+		t.Errorf("Expected the spill error but found %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the running command to be stopped but the run took %v", elapsed)
+	}
+
+	if !strings.Contains(stderr.String(), "1\tsleep 10\t") || !strings.Contains(stderr.String(), "2\tseq 5\t") {
+		t.Errorf("Expected the statuses of both commands but found %q", stderr.String())
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const bufferSize = 100
+
+// Запис от изпразнен лог заедно с поредния номер (от 1), името и етикетите
+// на източника му. Източниците без име получават поредния си номер за име.
+// Записите с Marker описват решение, взето заради застинал източник
+// (виж Drainer.IdleTimeout), и нямат Value.
+type Entry[T any] struct {
+	Source int
+	Name   string
+	Labels map[string]string
+	Value  T
+	Marker Marker
+	// Отместването в източника след този запис (виж CheckpointStore)
+	// или нула, ако не е известно.
+	end int
+}
+
+type registeredLog[T any] struct {
+	index   int
+	source  *Source[T]
+	entries chan T
+	// Отместването, от което е отворен източникът, и колко записа е
+	// прочел координаторът от entries след него.
+	offset int
+	read   int
+}
+
+func (l *registeredLog[T]) entry(value T) Entry[T] {
+	return Entry[T]{Source: l.index, Name: l.source.Name, Labels: l.source.Labels, Value: value, end: l.offset + l.read}
+}
+
+// Настройки на изпразването. Нулевата стойност държи всички
+// задържани записи в паметта.
+type Drainer[T any] struct {
+	// Колко записа общо може да се държат в паметта, докато чакат реда на
+	// лога си. Над тази граница записите се изливат във временни файлове в
+	// SpillDir (по подразбиране os.TempDir()) и се прочитат обратно, когато
+	// им дойде редът. Нула означава без ограничение. При ограничение T
+	// трябва да може да се кодира с encoding/gob.
+	MemoryBudget int
+	SpillDir     string
+	// Колко записа има в един файл на изливане.
+	SegmentSize int
+
+	// Ако е зададен, записите се сливат по собственото им време вместо по
+	// реда на логовете (виж mergeByTime). Записите с до AllowedLateness
+	// по-старо време от най-новото във всеки жив лог още се подреждат
+	// правилно, а по-късните се обработват според Late.
+	Timestamp       func(T) time.Time
+	AllowedLateness time.Duration
+	Late            LatePolicy
+	// Къде отиват закъснелите записи при LateSide. Затваря се
+	// след края на изпразването, затова следващо изпразване с d
+	// се нуждае от нов канал.
+	LateEntries chan Entry[T]
+
+	// Ако е зададен, източник, от който при реда му не е дошъл запис
+	// толкова време, се смята за застинал и се обработва според Stall.
+	// При сливане по време застиналият източник просто спира да задържа
+	// водната линия. Source.IdleTimeout има предимство пред него.
+	IdleTimeout time.Duration
+	Stall       StallPolicy
+
+	// Откъдето се вземат отместванията за източниците с Reopen.
+	Checkpoint *CheckpointStore
+
+	// Размерът на запис в байтове за Stats (виж entrySize).
+	Size  func(T) int
+	stats atomic.Pointer[drainStats]
+	// Последният затворен LateEntries.
+	closedLate atomic.Value
+}
+
+// Отхвърля настройките, които не се прилагат заедно: сливането по време
+// държи задържаните записи в паметта и не познава застиналите източници.
+func (d *Drainer[T]) validate() error {
+	if d.Timestamp != nil {
+		switch {
+		case d.MemoryBudget != 0 || d.SpillDir != "" || d.SegmentSize != 0:
+			return errors.New("MemoryBudget, SpillDir and SegmentSize cannot be combined with Timestamp")
+		case d.Stall != StallSkip:
+			return errors.New("Stall cannot be combined with Timestamp")
+		}
+	}
+
+	if closed, _ := d.closedLate.Load().(chan Entry[T]); d.LateEntries != nil && d.LateEntries == closed {
+		return errors.New("LateEntries was closed by a previous drain")
+	}
+
+	return nil
+}
+
+// Чете записите на log в неограничен буфер, за да не блокира
+// писането в логове, чийто ред още не е дошъл. Спира при прекратяване на ctx,
+// а при грешка при изливането на диска прекратява целия Drain с нея.
+func (d *Drainer[T]) bufferLog(ctx context.Context, fail context.CancelCauseFunc, budget *memoryBudget, stats *drainStats, index int, log chan T) chan T {
+	buffered := make(chan T)
+
+	if log == nil {
+		stats.close(index)
+		close(buffered)
+		return buffered
+	}
+
+	go func() {
+		var (
+			pending []T
+			next    T
+			hasNext bool
+		)
+
+		spilled := newSpillQueue[T](d.SpillDir, d.SegmentSize)
+		defer spilled.Close()
+
+		for log != nil || len(pending) > 0 || spilled.Len() > 0 || hasNext {
+			// Следващият за изпращане запис е извън бюджета: или е
+			// освободен от pending, или е прочетен обратно от диска.
+			if !hasNext && len(pending) > 0 {
+				next, pending = pending[0], pending[1:]
+				hasNext = true
+				budget.release()
+			} else if !hasNext && spilled.Len() > 0 {
+				var err error
+
+				if next, err = spilled.Pop(); err != nil {
+					fail(err)
+					return
+				}
+
+				hasNext = true
+			}
+
+			var out chan T
+
+			if hasNext {
+				out = buffered
+			}
+
+			select {
+			case logEntry, isOpen := <-log:
+				if !isOpen {
+					stats.close(index)
+					log = nil
+					continue
+				}
+
+				stats.receive(index, d.entrySize(logEntry))
+
+				// Веднъж излят, логът продължава да се излива, докато дискът
+				// не се изпразни, за да не се разбърка редът на записите.
+				if spilled.Len() == 0 && budget.tryAcquire() {
+					pending = append(pending, logEntry)
+				} else if err := spilled.Push(logEntry); err != nil {
+					fail(err)
+					return
+				}
+			case out <- next:
+				hasNext = false
+			case <-ctx.Done():
+				for range pending {
+					budget.release()
+				}
+
+				return
+			}
+		}
+
+		close(buffered)
+	}()
+
+	return buffered
+}
+
+// Слива логовете в реда, в който са регистрирани: всички записи на
+// лог 1 излизат преди който и да е запис на лог 2 и т.н. Записите на
+// по-късните логове се буферират, докато по-ранните са още отворени.
+//
+// Изходният канал се затваря точно веднъж - едва когато logs е затворен
+// и всеки регистриран лог е затворен и изцяло изпразнен. Затова logs
+// може да се затвори, докато в регистрираните логове още се пише.
+// Регистриран nil канал се смята за празен, затворен лог.
+func Drain[T any](logs chan (chan T)) <-chan Entry[T] {
+	entries, _ := DrainContext(context.Background(), logs)
+	return entries
+}
+
+// Като Drain, но при прекратяване на ctx спира да чете logs
+// и регистрираните логове, освобождава всичките си горутини и затваря
+// изходния канал, без да чака логовете да бъдат затворени.
+// След затварянето на изхода по втория канал идва nil, ако всичко е
+// изпразнено, или ctx.Err(), ако изпразването е прекъснато.
+func DrainContext[T any](ctx context.Context, logs chan (chan T)) (<-chan Entry[T], <-chan error) {
+	return (&Drainer[T]{}).Drain(ctx, logs)
+}
+
+// Като DrainContext, но с настройките на d. Ако изливането на диска
+// се провали, изпразването спира и грешката идва по втория канал.
+func (d *Drainer[T]) Drain(ctx context.Context, logs chan (chan T)) (<-chan Entry[T], <-chan error) {
+	return d.drain(ctx, logs, nil)
+}
+
+// Като Drain, но източниците се регистрират с имена и етикети,
+// които се пренасят във всеки изпразнен запис.
+func (d *Drainer[T]) DrainSources(ctx context.Context, sources chan *Source[T]) (<-chan Entry[T], <-chan error) {
+	return d.drain(ctx, nil, sources)
+}
+
+// Регистрацията идва или по logs, или по sources (другият е nil). Четат се
+// направо от координатора, за да е регистриран логът, щом изпращането му
+// приключи.
+func (d *Drainer[T]) drain(ctx context.Context, logs chan (chan T), sources chan *Source[T]) (<-chan Entry[T], <-chan error) {
+	if err := d.validate(); err != nil {
+		entries := make(chan Entry[T])
+		done := make(chan error, 1)
+		close(entries)
+		done <- err
+		close(done)
+		return entries, done
+	}
+
+	stats := newDrainStats()
+	d.stats.Store(stats)
+
+	if d.Timestamp != nil {
+		return d.mergeByTime(ctx, stats, logs, sources)
+	}
+
+	entries := make(chan Entry[T], bufferSize)
+	done := make(chan error, 1)
+	ctx, fail := context.WithCancelCause(ctx)
+	budget := &memoryBudget{limit: int64(d.MemoryBudget)}
+
+	go func() {
+		defer close(done)
+		defer close(entries)
+		defer fail(nil)
+
+		var (
+			queue []*registeredLog[T]
+			ready []Entry[T]
+			// Съседите на застинал източник, чиито буферирани записи
+			// излизат след GapMarker, по един през current.
+			gaps  []gapRead[T]
+			armed time.Time
+		)
+
+		timer := time.NewTimer(time.Hour)
+		defer timer.Stop()
+
+		i := 1
+		active := time.Now()
+		register := func(source *Source[T]) error {
+			named, offset, err := d.openSource(ctx, fail, i, source)
+
+			if err != nil {
+				return err
+			}
+
+			if len(queue) == 0 {
+				active = time.Now()
+			}
+
+			stats.add(i, named.Name, named.Labels)
+			queue = append(queue, &registeredLog[T]{index: i, source: named, offset: offset, entries: d.bufferLog(ctx, fail, budget, stats, i, named.Entries)})
+			i++
+			return nil
+		}
+
+		for logs != nil || sources != nil || len(queue) > 0 || len(ready) > 0 {
+			var (
+				reading *registeredLog[T]
+				current chan T
+				out     chan Entry[T]
+				next    Entry[T]
+				stalled <-chan time.Time
+			)
+
+			if len(ready) > 0 {
+				out, next = entries, ready[0]
+			} else if len(gaps) > 0 {
+				reading = gaps[0].log
+			} else if len(queue) > 0 {
+				reading = queue[0]
+
+				if timeout := reading.source.idleTimeout(d.IdleTimeout); timeout > 0 {
+					if deadline := active.Add(timeout); !deadline.Equal(armed) {
+						timer.Reset(time.Until(deadline))
+						armed = deadline
+					}
+
+					stalled = timer.C
+				}
+			}
+
+			if reading != nil {
+				current = reading.entries
+			}
+
+			select {
+			case log, isOpen := <-logs:
+				if !isOpen {
+					logs = nil
+					continue
+				}
+
+				if err := register(&Source[T]{Entries: log}); err != nil {
+					fail(err)
+					done <- err
+					return
+				}
+			case source, isOpen := <-sources:
+				if !isOpen {
+					sources = nil
+					continue
+				}
+
+				if err := register(source); err != nil {
+					fail(err)
+					done <- err
+					return
+				}
+			case logEntry, isOpen := <-current:
+				active = time.Now()
+
+				// Само първият източник може да се затвори тук: от
+				// съседите се четат единствено вече получени записи.
+				if !isOpen {
+					queue = queue[1:]
+					continue
+				}
+
+				reading.read++
+				ready = append(ready, reading.entry(logEntry))
+
+				if len(gaps) > 0 {
+					if gaps[0].count--; gaps[0].count == 0 {
+						gaps = gaps[1:]
+					}
+				}
+			case out <- next:
+				if next.Marker == NoMarker {
+					stats.emit(next.Source)
+				}
+
+				ready = ready[1:]
+				active = time.Now()
+			case <-stalled:
+				var err error
+
+				if queue, ready, gaps, err = d.stall(stats, queue, ready); err != nil {
+					fail(err)
+					done <- err
+					return
+				}
+
+				active = time.Now()
+			case <-ctx.Done():
+				done <- context.Cause(ctx)
+				return
+			}
+		}
+
+		done <- nil
+	}()
+
+	return entries, done
+}
+
+// Превръща изпразнените записи в низове с format. Отделна стъпка е,
+// за да може един и същ Drain да се извежда в различни формати.
+// Спира при прекратяване на ctx, дори ако никой не чете изхода.
+func Format[T any](ctx context.Context, entries <-chan Entry[T], format func(Entry[T]) string) chan string {
+	formatted := make(chan string, bufferSize)
+
+	go func() {
+		defer close(formatted)
+
+		for entry := range entries {
+			select {
+			case formatted <- format(entry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return formatted
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testEvent struct {
+	Level   string
+	Message string
+}
+
+func TestDrainStructuredEvents(t *testing.T) {
+	logs := make(chan (chan testEvent))
+	entries := Drain(logs)
+
+	first := make(chan testEvent)
+	second := make(chan testEvent)
+	logs <- first
+	logs <- second
+	close(logs)
+
+	second <- testEvent{"warn", "disk almost full"}
+	first <- testEvent{"info", "started"}
+	close(second)
+	first <- testEvent{"error", "crashed"}
+	close(first)
+
+	expected := []Entry[testEvent]{
+		{Source: 1, Name: "1", Value: testEvent{"info", "started"}, end: 1},
+		{Source: 1, Name: "1", Value: testEvent{"error", "crashed"}, end: 2},
+		{Source: 2, Name: "2", Value: testEvent{"warn", "disk almost full"}, end: 1},
+	}
+
+	var found []Entry[testEvent]
+
+	for entry := range entries {
+		found = append(found, entry)
+	}
+
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("Expected %v but found %v", expected, found)
+	}
+}
+
+func TestFormatIsPluggable(t *testing.T) {
+	logs := make(chan (chan int))
+	ctx := context.Background()
+	formatted := Format(ctx, Drain(logs), func(entry Entry[int]) string {
+		return fmt.Sprintf("[%d] %03d", entry.Source, entry.Value)
+	})
+
+	log := make(chan int)
+	logs <- log
+	close(logs)
+	log <- 7
+	log <- 42
+	close(log)
+
+	testDrained(t, []string{"[1] 007", "[1] 042"}, formatted)
+}
+
+func TestFormatStopsWhenNobodyReads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	entries := make(chan Entry[int])
+	formatted := Format(ctx, entries, func(entry Entry[int]) string { return fmt.Sprint(entry.Value) })
+
+	go func() {
+		for i := 0; i < 2*bufferSize; i++ {
+			select {
+			case entries <- Entry[int]{Source: 1, Value: i}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-testClosed(formatted):
+	case <-time.After(time.Second):
+		t.Fatal("Expected Format to stop after cancelling")
+	}
+}
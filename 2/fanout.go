@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Какво става със запис за абонат, чийто буфер е пълен.
+type SlowConsumerPolicy int
+
+const (
+	// Разпращането чака абоната, а с него и всички останали.
+	SlowBlock SlowConsumerPolicy = iota
+	// Най-старият непрочетен запис на абоната се изхвърля.
+	SlowDropOldest
+	// Абонатът се откача с ErrSlowConsumer.
+	SlowDisconnect
+)
+
+var ErrSlowConsumer = errors.New("subscriber too slow, disconnected")
+
+// Собственият подреден поток на един абонат на Fanout.
+type Subscription[T any] struct {
+	policy    SlowConsumerPolicy
+	entries   chan Entry[T]
+	cancelled chan struct{}
+	cancel    sync.Once
+
+	mutex    sync.Mutex
+	isClosed bool
+	// Докато разпращането чака абоната извън mutex, само то може да
+	// затвори entries, иначе би изпратило в затворен канал.
+	isSending bool
+	err       error
+	dropped   int
+}
+
+// Записите на абоната. Каналът се затваря в края на разпращането,
+// при откачане или след Close.
+func (s *Subscription[T]) Entries() <-chan Entry[T] {
+	return s.entries
+}
+
+// Защо е затворен Entries: nil, ако разпращането е завършило или абонатът
+// се е отписал, ErrSlowConsumer или причината за прекратяване на ctx.
+func (s *Subscription[T]) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err
+}
+
+// Колко записа са изхвърлени при SlowDropOldest.
+func (s *Subscription[T]) Dropped() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.dropped
+}
+
+// Отписва абоната. Entries се затваря веднага, дори ако разпращането
+// в момента чака абоната.
+func (s *Subscription[T]) Close() {
+	s.cancel.Do(func() { close(s.cancelled) })
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isSending {
+		s.closeLocked(nil)
+	}
+}
+
+func (s *Subscription[T]) close(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closeLocked(err)
+}
+
+func (s *Subscription[T]) closeLocked(err error) {
+	if !s.isClosed {
+		s.isClosed, s.err = true, err
+		close(s.entries)
+	}
+}
+
+// Изпраща entry според политиката на абоната и казва дали абонатът
+// още е абониран.
+func (s *Subscription[T]) send(ctx context.Context, entry Entry[T]) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isClosed {
+		return false
+	}
+
+	switch s.policy {
+	case SlowDropOldest:
+		for {
+			select {
+			case s.entries <- entry:
+				return true
+			default:
+			}
+
+			select {
+			case <-s.entries:
+				s.dropped++
+			default:
+			}
+		}
+	case SlowDisconnect:
+		select {
+		case s.entries <- entry:
+		default:
+			s.closeLocked(ErrSlowConsumer)
+			return false
+		}
+	default:
+		// Блокиращото изпращане е извън mutex, за да може абонатът
+		// междувременно да вика Err, Dropped и Close.
+		s.isSending = true
+		s.mutex.Unlock()
+
+		isSubscribed := true
+
+		select {
+		case s.entries <- entry:
+		case <-s.cancelled:
+			isSubscribed = false
+		case <-ctx.Done():
+		}
+
+		s.mutex.Lock()
+		s.isSending = false
+
+		// Close може да е дошъл, след като записът вече е изпратен, и
+		// да е оставил затварянето на entries на изпращащия.
+		select {
+		case <-s.cancelled:
+			isSubscribed = false
+		default:
+		}
+
+		if !isSubscribed {
+			s.closeLocked(nil)
+		}
+
+		return isSubscribed
+	}
+
+	return true
+}
+
+// Разпраща един поток от записи до няколко абоната, всеки със свой буфер.
+// Нулевата стойност е готова за употреба.
+type Fanout[T any] struct {
+	mutex       sync.Mutex
+	subscribers []*Subscription[T]
+	isDone      bool
+}
+
+// Абонира се за записите, разпратени след абонирането. buffer е колко
+// непрочетени записа може да чакат абоната, преди да се приложи policy
+// (при SlowDropOldest - поне един). След края на Run абонатите получават
+// затворен поток.
+func (f *Fanout[T]) Subscribe(buffer int, policy SlowConsumerPolicy) *Subscription[T] {
+	if policy == SlowDropOldest && buffer < 1 {
+		buffer = 1
+	}
+
+	s := &Subscription[T]{
+		policy:    policy,
+		entries:   make(chan Entry[T], buffer),
+		cancelled: make(chan struct{}),
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.isDone {
+		s.closeLocked(nil)
+		return s
+	}
+
+	f.subscribers = append(f.subscribers, s)
+	return s
+}
+
+// Разпраща entries до абонатите, докато entries не се затвори или ctx
+// не бъде прекратен, и накрая затваря потоците на всички абонати.
+func (f *Fanout[T]) Run(ctx context.Context, entries <-chan Entry[T]) {
+	defer func() {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+
+		for _, s := range f.subscribers {
+			s.close(context.Cause(ctx))
+		}
+
+		f.subscribers = nil
+		f.isDone = true
+	}()
+
+	for {
+		select {
+		case entry, isOpen := <-entries:
+			if !isOpen {
+				return
+			}
+
+			f.mutex.Lock()
+			subscribers := f.subscribers
+			f.mutex.Unlock()
+
+			var active []*Subscription[T]
+
+			for _, s := range subscribers {
+				if s.send(ctx, entry) {
+					active = append(active, s)
+				}
+			}
+
+			f.forget(subscribers, active)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Маха отписаните абонати, като пази абонираните по време на разпращането.
+func (f *Fanout[T]) forget(sent, active []*Subscription[T]) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.subscribers = append(active, f.subscribers[len(sent):]...)
+}
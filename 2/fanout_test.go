@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testPublish(count int) chan Entry[string] {
+	entries := make(chan Entry[string])
+
+	go func() {
+		for i := 1; i <= count; i++ {
+			entries <- Entry[string]{Source: 1, Value: fmt.Sprint(i)}
+		}
+
+		close(entries)
+	}()
+
+	return entries
+}
+
+func testValues(subscription *Subscription[string]) []string {
+	var values []string
+
+	for entry := range subscription.Entries() {
+		values = append(values, entry.Value)
+	}
+
+	return values
+}
+
+func TestFanoutGivesEverySubscriberTheWholeStream(t *testing.T) {
+	var fanout Fanout[string]
+	subscriptions := []*Subscription[string]{
+		fanout.Subscribe(0, SlowBlock),
+		fanout.Subscribe(1, SlowBlock),
+		fanout.Subscribe(100, SlowBlock),
+	}
+
+	go fanout.Run(context.Background(), testPublish(50))
+
+	// Абонатите четат едновременно, иначе блокиращите се чакат един друг.
+	results := make([]chan []string, len(subscriptions))
+
+	for i, subscription := range subscriptions {
+		results[i] = make(chan []string, 1)
+		go func() { results[i] <- testValues(subscription) }()
+	}
+
+	for i, subscription := range subscriptions {
+		found := <-results[i]
+
+		if len(found) != 50 || found[0] != "1" || found[49] != "50" {
+			t.Errorf("Expected subscriber %d to get all 50 entries in order but found %v", i, found)
+		}
+
+		if err := subscription.Err(); err != nil {
+			t.Errorf("Expected subscriber %d to finish cleanly but found %v", i, err)
+		}
+	}
+}
+
+func TestFanoutDropOldest(t *testing.T) {
+	var fanout Fanout[string]
+	subscription := fanout.Subscribe(2, SlowDropOldest)
+	fanout.Run(context.Background(), testPublish(5))
+
+	if found := testValues(subscription); fmt.Sprint(found) != "[4 5]" {
+		t.Errorf("Expected only the newest entries but found %v", found)
+	}
+
+	if dropped := subscription.Dropped(); dropped != 3 {
+		t.Errorf("Expected 3 dropped entries but found %d", dropped)
+	}
+}
+
+func TestFanoutDisconnectsSlowSubscriber(t *testing.T) {
+	var fanout Fanout[string]
+	slow := fanout.Subscribe(1, SlowDisconnect)
+	fast := fanout.Subscribe(0, SlowBlock)
+
+	go fanout.Run(context.Background(), testPublish(3))
+
+	if found := testValues(fast); len(found) != 3 {
+		t.Errorf("Expected the fast subscriber to get every entry but found %v", found)
+	}
+
+	if found := testValues(slow); fmt.Sprint(found) != "[1]" {
+		t.Errorf("Expected the slow subscriber to get only what fit in its buffer but found %v", found)
+	}
+
+	if err := slow.Err(); !errors.Is(err, ErrSlowConsumer) {
+		t.Errorf("Expected the slow subscriber to be disconnected but found %v", err)
+	}
+}
+
+func TestFanoutCloseReleasesBlockedSubscriber(t *testing.T) {
+	var fanout Fanout[string]
+	stuck := fanout.Subscribe(0, SlowBlock)
+	other := fanout.Subscribe(10, SlowBlock)
+
+	go fanout.Run(context.Background(), testPublish(3))
+
+	time.Sleep(10 * time.Millisecond)
+	stuck.Close()
+
+	if found := testValues(other); len(found) != 3 {
+		t.Errorf("Expected the other subscriber to get every entry but found %v", found)
+	}
+
+	if found := testValues(stuck); len(found) != 0 {
+		t.Errorf("Expected nothing for the closed subscriber but found %v", found)
+	}
+}
+
+func TestFanoutFeedsSeveralFormattedStreams(t *testing.T) {
+	ctx := context.Background()
+	logs := make(chan (chan string))
+	entries, _ := DrainContext(ctx, logs)
+
+	var fanout Fanout[string]
+	plain := Format(ctx, fanout.Subscribe(10, SlowBlock).Entries(), FormatLogEntry)
+	named := Format(ctx, fanout.Subscribe(10, SlowBlock).Entries(), FormatSourceEntry[string])
+
+	go fanout.Run(ctx, entries)
+
+	log := make(chan string)
+	logs <- log
+	close(logs)
+	log <- "hello"
+	close(log)
+
+	testDrained(t, []string{"1\thello"}, plain)
+	testDrained(t, []string{"1\thello"}, named)
+}
+
+func TestFanoutBlockedSubscriberCanQueryItself(t *testing.T) {
+	var fanout Fanout[string]
+	subscription := fanout.Subscribe(1, SlowBlock)
+
+	go fanout.Run(context.Background(), testPublish(3))
+
+	// Буферът е пълен и разпращането чака абоната.
+	time.Sleep(10 * time.Millisecond)
+	queried := make(chan struct{})
+
+	go func() {
+		subscription.Err()
+		subscription.Dropped()
+		close(queried)
+	}()
+
+	select {
+	case <-queried:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Err and Dropped not to wait for the blocked send")
+	}
+
+	if found := testValues(subscription); fmt.Sprint(found) != "[1 2 3]" {
+		t.Errorf("Expected every entry after the queries but found %v", found)
+	}
+}
+
+func TestFanoutCloseDuringDeliveredSendClosesEntries(t *testing.T) {
+	var fanout Fanout[string]
+	subscription := fanout.Subscribe(0, SlowBlock)
+	entries := make(chan Entry[string])
+
+	go fanout.Run(context.Background(), entries)
+	go func() { entries <- Entry[string]{Source: 1, Value: "x"} }()
+
+	for {
+		subscription.mutex.Lock()
+
+		if subscription.isSending {
+			break
+		}
+
+		subscription.mutex.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	// Записът е получен, но изпращането още не е взело mutex обратно,
+	// когато Close минава изцяло (както в Close, докато isSending е вярно).
+	<-subscription.entries
+	subscription.cancel.Do(func() { close(subscription.cancelled) })
+	subscription.mutex.Unlock()
+
+	select {
+	case _, isOpen := <-subscription.Entries():
+		if isOpen {
+			t.Fatal("Expected no entries after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to close Entries")
+	}
+}
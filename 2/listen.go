@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Регистрира всяка приета от listener връзка (TCP или Unix) като нов
+// източник в реда на приемане. Всеки ред от връзката е запис, а
+// затварянето на връзката затваря източника. Източникът се казва като
+// отсрещния адрес и има етикети network и remote (ако адресът е известен).
+//
+// Регистрацията приключва, когато listener бъде затворен; вече
+// приетите връзки продължават, докато отсрещната страна не ги затвори.
+// При прекратяване на ctx се затварят и listener, и всички връзки.
+// Когато и регистрацията, и всички връзки приключат, по втория канал
+// идват грешката от Accept и грешките при четене от връзките (например
+// ред, по-дълъг от bufio.MaxScanTokenSize), или nil, ако няма такива.
+func ListenSources(ctx context.Context, listener net.Listener) (chan *Source[string], <-chan error) {
+	return listenSources(ctx, listener, bufio.ScanLines)
+}
+
+// Като ListenSources, но записите от връзките се отделят със split.
+func listenSources(ctx context.Context, listener net.Listener, split bufio.SplitFunc) (chan *Source[string], <-chan error) {
+	sources := make(chan *Source[string])
+	done := make(chan error, 1)
+
+	var (
+		mutex sync.Mutex
+		conns = map[net.Conn]struct{}{}
+		errs  []error
+		wait  sync.WaitGroup
+	)
+
+	context.AfterFunc(ctx, func() {
+		listener.Close()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		for conn := range conns {
+			conn.Close()
+		}
+	})
+
+	finish := func(conn net.Conn, err error) {
+		conn.Close()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		delete(conns, conn)
+
+		if err != nil && ctx.Err() == nil {
+			errs = append(errs, fmt.Errorf("connection from %s: %w", conn.RemoteAddr(), err))
+		}
+	}
+
+	go func() {
+		defer close(done)
+
+		err := acceptSources(ctx, listener, sources, func(conn net.Conn, lines chan string) bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			// AfterFunc може вече да е затворил всички известни връзки.
+			if ctx.Err() != nil {
+				conn.Close()
+				return false
+			}
+
+			conns[conn] = struct{}{}
+			wait.Add(1)
+
+			go func() {
+				defer wait.Done()
+				finish(conn, readLines(ctx, conn, split, lines))
+			}()
+
+			return true
+		})
+
+		close(sources)
+		wait.Wait()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		done <- errors.Join(append([]error{err}, errs...)...)
+	}()
+
+	return sources, done
+}
+
+// Приема връзки и ги регистрира, докато listener не бъде затворен.
+// start започва четенето на връзката и казва дали тя да бъде регистрирана.
+func acceptSources(ctx context.Context, listener net.Listener, sources chan<- *Source[string], start func(net.Conn, chan string) bool) error {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return context.Cause(ctx)
+			}
+
+			return err
+		}
+
+		// Отсрещният адрес на Unix връзките обикновено е празен и
+		// тогава източникът получава поредния си номер за име.
+		remote := conn.RemoteAddr().String()
+		source := &Source[string]{
+			Name:    remote,
+			Labels:  map[string]string{"network": listener.Addr().Network()},
+			Entries: make(chan string),
+		}
+
+		if remote != "" {
+			source.Labels["remote"] = remote
+		}
+
+		if !start(conn, source.Entries) {
+			continue
+		}
+
+		select {
+		case sources <- source:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// Праща отделените със split записи на conn в lines и затваря lines,
+// когато връзката бъде затворена или четенето се провали.
+func readLines(ctx context.Context, conn net.Conn, split bufio.SplitFunc, lines chan string) error {
+	defer close(lines)
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(split)
+
+	for scanner.Scan() {
+		select {
+		case lines <- scanner.Text():
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
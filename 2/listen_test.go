@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenSourcesInAcceptOrder(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			address := "127.0.0.1:0"
+
+			if network == "unix" {
+				address = filepath.Join(t.TempDir(), "drain.sock")
+			}
+
+			listener, err := net.Listen(network, address)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			sources, accepted := ListenSources(ctx, listener)
+			entries, _ := (&Drainer[string]{}).DrainSources(ctx, sources)
+			orderedLog := Format(ctx, entries, func(entry Entry[string]) string {
+				return fmt.Sprintf("%d\t%s\t%s", entry.Source, entry.Labels["network"], entry.Value)
+			})
+
+			first, err := net.Dial(network, listener.Addr().String())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fmt.Fprint(first, "first 1\n")
+
+			if logEntry := <-orderedLog; logEntry != "1\t"+network+"\tfirst 1" {
+				t.Fatalf("Expected the first line of the first connection but found %q", logEntry)
+			}
+
+			second, err := net.Dial(network, listener.Addr().String())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fmt.Fprint(second, "second 1\nsecond 2\n")
+			second.Close()
+			fmt.Fprint(first, "first 2\nunterminated")
+			first.Close()
+
+			expected := []string{
+				"1\t" + network + "\tfirst 2",
+				"1\t" + network + "\tunterminated",
+				"2\t" + network + "\tsecond 1",
+				"2\t" + network + "\tsecond 2",
+			}
+
+			for _, expected := range expected {
+				if logEntry := <-orderedLog; logEntry != expected {
+					t.Fatalf("Expected %q but found %q", expected, logEntry)
+				}
+			}
+
+			listener.Close()
+			testDrained(t, nil, orderedLog)
+
+			if err := <-accepted; err != nil {
+				t.Errorf("Expected closing the listener to end the registration cleanly but found %v", err)
+			}
+		})
+	}
+}
+
+func TestListenSourcesCancelClosesConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sources, _ := ListenSources(ctx, listener)
+	entries, done := (&Drainer[string]{}).DrainSources(ctx, sources)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	fmt.Fprint(conn, "hello\n")
+
+	if entry := <-entries; entry.Value != "hello" || entry.Labels["remote"] != conn.LocalAddr().String() {
+		t.Errorf("Expected the line with the remote address but found %+v", entry)
+	}
+
+	cancel()
+
+	for range entries {
+	}
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the drain to be cancelled but found %v", err)
+	}
+
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("Expected the connection to be closed by the collector")
+	}
+}
+
+func TestListenSourcesReportsOverlongLines(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	sources, accepted := ListenSources(ctx, listener)
+	entries, _ := (&Drainer[string]{}).DrainSources(ctx, sources)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	fmt.Fprint(conn, "short\n")
+
+	if entry := <-entries; entry.Value != "short" {
+		t.Fatalf("Expected the short line first but found %q", entry.Value)
+	}
+
+	go conn.Write(make([]byte, 2*bufio.MaxScanTokenSize))
+	listener.Close()
+
+	for range entries {
+	}
+
+	if err := <-accepted; !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("Expected the overlong line to be reported but found %v", err)
+	}
+}
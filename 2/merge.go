@@ -0,0 +1,338 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+// Какво става със запис, чието време е преди водната линия, т.е. след
+// като вече са изведени по-нови от него записи.
+type LatePolicy int
+
+const (
+	// Закъснелият запис се извежда веднага, извън хронологичния ред.
+	LateEmit LatePolicy = iota
+	// Закъснелият запис се пропуска.
+	LateDrop
+	// Закъснелият запис се изпраща в Drainer.LateEntries.
+	LateSide
+)
+
+type arrival[T any] struct {
+	index    int
+	value    T
+	isClosed bool
+}
+
+type timedEntry[T any] struct {
+	time  time.Time
+	seq   int
+	entry Entry[T]
+}
+
+// Записите, чакащи водната линия, подредени по време, а при равно
+// време - по реда на пристигане.
+type entryHeap[T any] []timedEntry[T]
+
+func (h entryHeap[T]) Len() int { return len(h) }
+
+func (h entryHeap[T]) Less(i, j int) bool {
+	if h[i].time.Equal(h[j].time) {
+		return h[i].seq < h[j].seq
+	}
+
+	return h[i].time.Before(h[j].time)
+}
+
+func (h entryHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *entryHeap[T]) Push(x any) { *h = append(*h, x.(timedEntry[T])) }
+
+func (h *entryHeap[T]) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// Препраща записите на log към общия канал arrivals, а накрая
+// съобщава, че логът е затворен.
+func forwardLog[T any](ctx context.Context, index int, log chan T, arrivals chan<- arrival[T]) {
+	for {
+		var (
+			value  T
+			isOpen bool
+		)
+
+		if log != nil {
+			select {
+			case value, isOpen = <-log:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case arrivals <- arrival[T]{index, value, !isOpen}:
+		case <-ctx.Done():
+			return
+		}
+
+		if !isOpen {
+			return
+		}
+	}
+}
+
+// Слива записите на всички живи логове по d.Timestamp. Водната линия е
+// най-старото от последните времена на живите логове минус
+// d.AllowedLateness и никога не намалява. Записите до нея излизат
+// хронологично; дотогава се държат в паметта (затова MemoryBudget и
+// SpillDir не могат да се зададат заедно с Timestamp). Докато някой жив лог още няма записи, водната линия не
+// може да се определи и нищо не излиза. Ако няма живи логове,
+// излиза всичко задържано.
+//
+// Лог, от който не е дошъл запис за времето на IdleTimeout (неговото или
+// на d), спира да задържа водната линия, докато не прати нов запис.
+// Записите му, по-стари от вече изведените, се обработват според Late.
+func (d *Drainer[T]) mergeByTime(ctx context.Context, stats *drainStats, logs chan (chan T), sources chan *Source[T]) (<-chan Entry[T], <-chan error) {
+	entries := make(chan Entry[T], bufferSize)
+	done := make(chan error, 1)
+	arrivals := make(chan arrival[T])
+	ctx, fail := context.WithCancelCause(ctx)
+
+	go func() {
+		defer close(done)
+		defer close(entries)
+		defer fail(nil)
+
+		if late := d.LateEntries; late != nil {
+			defer func() {
+				d.closedLate.Store(late)
+				close(late)
+			}()
+		}
+
+		var (
+			pending      entryHeap[T]
+			watermark    time.Time
+			hasWatermark bool
+			newest       time.Time
+			seq          int
+		)
+
+		registered := map[int]*Source[T]{}
+		latest := map[int]time.Time{}
+		// Кога е регистриран логът или кога е дошъл последният му запис.
+		seen := map[int]time.Time{}
+		// Отместването в източника след последния пристигнал запис.
+		offsets := map[int]int{}
+		timer := time.NewTimer(time.Hour)
+		defer timer.Stop()
+
+		var armed time.Time
+
+		i := 1
+		register := func(source *Source[T]) error {
+			named, offset, err := d.openSource(ctx, fail, i, source)
+
+			if err != nil {
+				return err
+			}
+
+			registered[i] = named
+			offsets[i] = offset
+			seen[i] = time.Now()
+			stats.add(i, named.Name, named.Labels)
+			go forwardLog(ctx, i, named.Entries, arrivals)
+			i++
+			return nil
+		}
+
+		for logs != nil || sources != nil || len(registered) > 0 || len(pending) > 0 {
+			live, wake := d.liveLogs(registered, seen, time.Now())
+
+			if candidate, ok := d.watermark(live, latest, newest, len(pending) > 0); ok && (!hasWatermark || candidate.After(watermark)) {
+				watermark, hasWatermark = candidate, true
+			}
+
+			var idle <-chan time.Time
+
+			if !wake.IsZero() {
+				if !wake.Equal(armed) {
+					timer.Reset(time.Until(wake))
+					armed = wake
+				}
+
+				idle = timer.C
+			}
+
+			var out chan Entry[T]
+
+			if len(pending) > 0 && hasWatermark && !pending[0].time.After(watermark) {
+				out = entries
+			}
+
+			var next Entry[T]
+
+			if out != nil {
+				next = pending[0].entry
+			}
+
+			select {
+			case log, isOpen := <-logs:
+				if !isOpen {
+					logs = nil
+					continue
+				}
+
+				if err := register(&Source[T]{Entries: log}); err != nil {
+					fail(err)
+					done <- err
+					return
+				}
+			case source, isOpen := <-sources:
+				if !isOpen {
+					sources = nil
+					continue
+				}
+
+				if err := register(source); err != nil {
+					fail(err)
+					done <- err
+					return
+				}
+			case logEntry := <-arrivals:
+				if logEntry.isClosed {
+					stats.close(logEntry.index)
+					delete(registered, logEntry.index)
+					delete(latest, logEntry.index)
+					delete(seen, logEntry.index)
+					delete(offsets, logEntry.index)
+					continue
+				}
+
+				stats.receive(logEntry.index, d.entrySize(logEntry.value))
+				seen[logEntry.index] = time.Now()
+				offsets[logEntry.index]++
+				source := registered[logEntry.index]
+				entry := Entry[T]{Source: logEntry.index, Name: source.Name, Labels: source.Labels, Value: logEntry.value, end: offsets[logEntry.index]}
+				at := d.Timestamp(logEntry.value)
+
+				if last, ok := latest[logEntry.index]; !ok || at.After(last) {
+					latest[logEntry.index] = at
+				}
+
+				if at.After(newest) {
+					newest = at
+				}
+
+				if hasWatermark && at.Before(watermark) {
+					switch d.Late {
+					case LateDrop:
+						stats.drop(logEntry.index)
+
+						if err := d.Checkpoint.skip(entry.Name, entry.end); err != nil {
+							fail(err)
+							done <- err
+							return
+						}
+
+						continue
+					case LateSide:
+						if d.LateEntries == nil {
+							stats.drop(logEntry.index)
+
+							if err := d.Checkpoint.skip(entry.Name, entry.end); err != nil {
+								fail(err)
+								done <- err
+								return
+							}
+
+							continue
+						}
+
+						select {
+						case d.LateEntries <- entry:
+							stats.emit(logEntry.index)
+						case <-ctx.Done():
+							done <- context.Cause(ctx)
+							return
+						}
+
+						continue
+					}
+				}
+
+				heap.Push(&pending, timedEntry[T]{at, seq, entry})
+				seq++
+			case out <- next:
+				stats.emit(next.Source)
+				heap.Pop(&pending)
+			case <-idle:
+				// Някой лог е застинал; водната линия се преизчислява.
+			case <-ctx.Done():
+				done <- context.Cause(ctx)
+				return
+			}
+		}
+
+		done <- nil
+	}()
+
+	return entries, done
+}
+
+// Логовете, които не са застинали към now, и най-ранният момент, в
+// който някой от тях ще застине (нула, ако никой няма IdleTimeout).
+func (d *Drainer[T]) liveLogs(registered map[int]*Source[T], seen map[int]time.Time, now time.Time) (map[int]bool, time.Time) {
+	live := make(map[int]bool, len(registered))
+
+	var wake time.Time
+
+	for index, source := range registered {
+		timeout := source.idleTimeout(d.IdleTimeout)
+
+		if timeout <= 0 {
+			live[index] = true
+			continue
+		}
+
+		if deadline := seen[index].Add(timeout); deadline.After(now) {
+			live[index] = true
+
+			if wake.IsZero() || deadline.Before(wake) {
+				wake = deadline
+			}
+		}
+	}
+
+	return live, wake
+}
+
+// Водната линия според текущите живи логове, ако може да се определи.
+func (d *Drainer[T]) watermark(live map[int]bool, latest map[int]time.Time, newest time.Time, hasPending bool) (time.Time, bool) {
+	if len(live) == 0 {
+		return newest, hasPending
+	}
+
+	var (
+		oldest    time.Time
+		hasOldest bool
+	)
+
+	for index := range live {
+		at, ok := latest[index]
+
+		if !ok {
+			return time.Time{}, false
+		}
+
+		if !hasOldest || at.Before(oldest) {
+			oldest, hasOldest = at, true
+		}
+	}
+
+	return oldest.Add(-d.AllowedLateness), true
+}
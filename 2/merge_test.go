@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Времето на записите в тестовете е броят секунди в началото им.
+func testTimestamp(logEntry string) time.Time {
+	seconds, _ := strconv.Atoi(strings.Fields(logEntry)[0])
+	return time.Unix(int64(seconds), 0)
+}
+
+func TestMergeByTimeInterleavesLogs(t *testing.T) {
+	logs := make(chan (chan string))
+	orderedLog, done := OrderedLogDrainerWith(context.Background(), &Drainer[string]{Timestamp: testTimestamp}, logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+	close(logs)
+
+	go func() {
+		for _, logEntry := range []string{"1 a", "4 b", "5 c"} {
+			first <- logEntry
+		}
+
+		close(first)
+	}()
+
+	go func() {
+		for _, logEntry := range []string{"2 x", "3 y", "6 z"} {
+			second <- logEntry
+		}
+
+		close(second)
+	}()
+
+	expected := []string{"1\t1 a", "2\t2 x", "2\t3 y", "1\t4 b", "1\t5 c", "2\t6 z"}
+	testDrained(t, expected, orderedLog)
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected the merge to complete but found %v", err)
+	}
+}
+
+func TestMergeByTimeWaitsForEveryLiveLog(t *testing.T) {
+	logs := make(chan (chan string))
+	orderedLog, _ := OrderedLogDrainerWith(context.Background(), &Drainer[string]{Timestamp: testTimestamp}, logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+	first <- "5 a"
+
+	select {
+	case logEntry := <-orderedLog:
+		t.Fatalf("Expected nothing before the second log is written to but found %q", logEntry)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	second <- "3 b"
+	close(second)
+	close(first)
+	close(logs)
+
+	testDrained(t, []string{"2\t3 b", "1\t5 a"}, orderedLog)
+}
+
+func TestMergeByTimeLateEntries(t *testing.T) {
+	cases := []struct {
+		name     string
+		drainer  *Drainer[string]
+		before   int
+		expected []string
+		late     []string
+	}{
+		{"emit", &Drainer[string]{Late: LateEmit}, 2, []string{"1\t10 a", "2\t20 b", "2\t15 late", "1\t30 c"}, nil},
+		{"drop", &Drainer[string]{Late: LateDrop}, 2, []string{"1\t10 a", "2\t20 b", "1\t30 c"}, nil},
+		{"side", &Drainer[string]{Late: LateSide, LateEntries: make(chan Entry[string], 1)}, 2, []string{"1\t10 a", "2\t20 b", "1\t30 c"}, []string{"15 late"}},
+		{"allowed lateness", &Drainer[string]{Late: LateDrop, AllowedLateness: 10 * time.Second}, 1, []string{"1\t10 a", "2\t15 late", "2\t20 b", "1\t30 c"}, nil},
+	}
+
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			test.drainer.Timestamp = testTimestamp
+			logs := make(chan (chan string))
+			orderedLog, _ := OrderedLogDrainerWith(context.Background(), test.drainer, logs)
+
+			first := make(chan string)
+			second := make(chan string)
+			logs <- first
+			logs <- second
+			close(logs)
+
+			first <- "10 a"
+			second <- "20 b"
+			first <- "30 c"
+
+			// Изчакваме водната линия да мине през записите преди
+			// закъснелия, за да е сигурно кога той пристига.
+			for _, expected := range test.expected[:test.before] {
+				if logEntry := <-orderedLog; logEntry != expected {
+					t.Fatalf("Expected %q but found %q", expected, logEntry)
+				}
+			}
+
+			second <- "15 late"
+			close(second)
+			close(first)
+
+			testDrained(t, test.expected[test.before:], orderedLog)
+
+			var late []string
+
+			if test.drainer.LateEntries != nil {
+				for entry := range test.drainer.LateEntries {
+					late = append(late, entry.Value)
+				}
+			}
+
+			if strings.Join(late, "\n") != strings.Join(test.late, "\n") {
+				t.Errorf("Expected late entries %q but found %q", test.late, late)
+			}
+		})
+	}
+}
+
+func TestMergeByTimeRejectsIgnoredSettings(t *testing.T) {
+	for _, d := range []*Drainer[string]{
+		{Timestamp: testTimestamp, MemoryBudget: 10},
+		{Timestamp: testTimestamp, SpillDir: t.TempDir()},
+		{Timestamp: testTimestamp, Stall: StallFail},
+	} {
+		logs := make(chan (chan string))
+		entries, done := d.Drain(context.Background(), logs)
+
+		for range entries {
+		}
+
+		if err := <-done; err == nil {
+			t.Errorf("Expected %+v to be rejected", d)
+		}
+	}
+}
+
+func TestMergeByTimeRejectsClosedLateEntries(t *testing.T) {
+	d := &Drainer[string]{Timestamp: testTimestamp, Late: LateSide, LateEntries: make(chan Entry[string])}
+	logs := make(chan (chan string))
+	close(logs)
+	entries, done := d.Drain(context.Background(), logs)
+
+	for range entries {
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Повторното изпразване с вече затворения канал не бива да панира.
+	entries, done = d.Drain(context.Background(), make(chan (chan string)))
+
+	for range entries {
+	}
+
+	if err := <-done; err == nil {
+		t.Error("Expected the closed LateEntries to be rejected")
+	}
+
+	d.LateEntries = make(chan Entry[string])
+	logs = make(chan (chan string))
+	close(logs)
+	entries, done = d.Drain(context.Background(), logs)
+
+	for range entries {
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected a new LateEntries to be accepted but found %v", err)
+	}
+}
+
+func TestMergeByTimeIdleLogStopsHoldingTheWatermark(t *testing.T) {
+	logs := make(chan (chan string))
+	d := &Drainer[string]{Timestamp: testTimestamp, IdleTimeout: 20 * time.Millisecond, Late: LateDrop}
+	orderedLog, _ := OrderedLogDrainerWith(context.Background(), d, logs)
+
+	silent := make(chan string)
+	busy := make(chan string)
+	logs <- silent
+	logs <- busy
+	busy <- "1 a"
+	busy <- "2 b"
+
+	for _, expected := range []string{"2\t1 a", "2\t2 b"} {
+		select {
+		case logEntry := <-orderedLog:
+			if logEntry != expected {
+				t.Fatalf("Expected %q but found %q", expected, logEntry)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the silent log to stop holding back the others")
+		}
+	}
+
+	silent <- "0 too late"
+	silent <- "3 c"
+	close(silent)
+	close(busy)
+	close(logs)
+
+	testDrained(t, []string{"1\t3 c"}, orderedLog)
+}
@@ -1,3 +1,7 @@
+//go:build ignore
+
+// Стар чернови вариант на solution.go, който не се компилира заедно с него.
+
 package main
 
 import (
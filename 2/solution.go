@@ -1,63 +1,83 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
 )
 
+// Форматът на OrderedLogDrainer: номер на лога, табулация и записът.
+// Служебните записи се извеждат като "номер\t-- описание --".
+func FormatLogEntry(entry Entry[string]) string {
+	if entry.Marker != NoMarker {
+		return fmt.Sprintf("%d\t-- %s --", entry.Source, entry.Marker)
+	}
+
+	return fmt.Sprintf("%d\t%s", entry.Source, entry.Value)
+}
+
+// Слива логовете в реда, в който са регистрирани, и ги форматира с
+// FormatLogEntry. Подробностите за реда и затварянето са описани при Drain.
 func OrderedLogDrainer(logs chan (chan string)) chan string {
-	mergedLogs := make(chan string, 100)
+	mergedLogs, _ := OrderedLogDrainerContext(context.Background(), logs)
+	return mergedLogs
+}
 
-	go func() {
-		i := 1
+// Като OrderedLogDrainer, но може да бъде прекратен през ctx (виж DrainContext).
+// След затварянето на изхода по втория канал идва nil, ако всичко е
+// изпразнено, или ctx.Err(), ако изпразването е прекъснато.
+func OrderedLogDrainerContext(ctx context.Context, logs chan (chan string)) (chan string, <-chan error) {
+	return OrderedLogDrainerWith(ctx, &Drainer[string]{}, logs)
+}
 
-		for log := range logs {
-			go func(i int) {
-				for logEntry := range log {
-					mergedLogs <- fmt.Sprintf("%d\t%s", i, logEntry)
-				}
-			}(i)
+// Като OrderedLogDrainerContext, но с настройките на d - например
+// сливане по времето на записите вместо по реда на логовете.
+func OrderedLogDrainerWith(ctx context.Context, d *Drainer[string], logs chan (chan string)) (chan string, <-chan error) {
+	entries, done := d.Drain(ctx, logs)
+	return Format(ctx, entries, FormatLogEntry), done
+}
 
-			i++
+func main() {
+	if len(os.Args) > 1 {
+		if err := runCommands(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintln(os.Stderr, "ordered-drain:", err)
+			os.Exit(1)
 		}
 
-		close(mergedLogs)
-	}()
+		return
+	}
 
-	return mergedLogs
-}
+	logs := make(chan (chan string))
+	orderedLog := OrderedLogDrainer(logs)
 
-func main() {
-    logs := make(chan (chan string))
-    orderedLog := OrderedLogDrainer(logs)
-
-    first := make(chan string)
-    logs <- first
-    second := make(chan string)
-    logs <- second
-
-    first <- "test message 1 in first"
-    second <- "test message 1 in second"
-    second <- "test message 2 in second"
-    first <- "test message 2 in first"
-    first <- "test message 3 in first"
-    // Print the first message now just because we can
-    fmt.Println(<-orderedLog)
-
-    third := make(chan string)
-    logs <- third
-
-    third <- "test message 1 in third"
-    first <- "test message 4 in first"
-    close(first)
-    second <- "test message 3 in second"
-    close(third)
-    close(logs)
-
-    second <- "test message 4 in second"
-    close(second)
-
-    // Print all the rest of the messages
-    for logEntry := range orderedLog {
-        fmt.Println(logEntry)
-    }
+	first := make(chan string)
+	logs <- first
+	second := make(chan string)
+	logs <- second
+
+	first <- "test message 1 in first"
+	second <- "test message 1 in second"
+	second <- "test message 2 in second"
+	first <- "test message 2 in first"
+	first <- "test message 3 in first"
+	// Print the first message now just because we can
+	fmt.Println(<-orderedLog)
+
+	third := make(chan string)
+	logs <- third
+
+	third <- "test message 1 in third"
+	first <- "test message 4 in first"
+	close(first)
+	second <- "test message 3 in second"
+	close(third)
+	close(logs)
+
+	second <- "test message 4 in second"
+	close(second)
+
+	// Print all the rest of the messages
+	for logEntry := range orderedLog {
+		fmt.Println(logEntry)
+	}
 }
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDemoOrder(t *testing.T) {
+	logs := make(chan (chan string))
+	orderedLog := OrderedLogDrainer(logs)
+
+	first := make(chan string)
+	logs <- first
+	second := make(chan string)
+	logs <- second
+
+	first <- "test message 1 in first"
+	second <- "test message 1 in second"
+	second <- "test message 2 in second"
+	first <- "test message 2 in first"
+	first <- "test message 3 in first"
+
+	if logEntry := <-orderedLog; logEntry != "1\ttest message 1 in first" {
+		t.Errorf("Expected the first message of the first log but found %q", logEntry)
+	}
+
+	third := make(chan string)
+	logs <- third
+
+	third <- "test message 1 in third"
+	first <- "test message 4 in first"
+	close(first)
+	second <- "test message 3 in second"
+	close(third)
+	close(logs)
+
+	second <- "test message 4 in second"
+	close(second)
+
+	expected := []string{
+		"1\ttest message 2 in first",
+		"1\ttest message 3 in first",
+		"1\ttest message 4 in first",
+		"2\ttest message 1 in second",
+		"2\ttest message 2 in second",
+		"2\ttest message 3 in second",
+		"2\ttest message 4 in second",
+		"3\ttest message 1 in third",
+	}
+
+	testDrained(t, expected, orderedLog)
+}
+
+func TestLaterLogsDoNotBlockWhileEarlierIsOpen(t *testing.T) {
+	logs := make(chan (chan string))
+	orderedLog := OrderedLogDrainer(logs)
+
+	first := make(chan string)
+	logs <- first
+
+	for i := 2; i <= 10; i++ {
+		log := make(chan string)
+		logs <- log
+
+		for j := 0; j < 1000; j++ {
+			log <- fmt.Sprint(j)
+		}
+
+		close(log)
+	}
+
+	close(logs)
+
+	select {
+	case logEntry := <-orderedLog:
+		t.Fatalf("Expected nothing before the first log is written to but found %q", logEntry)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	first <- "finally"
+	close(first)
+
+	if logEntry := <-orderedLog; logEntry != "1\tfinally" {
+		t.Errorf("Expected the first log to come first but found %q", logEntry)
+	}
+
+	count := 0
+
+	for range orderedLog {
+		count++
+	}
+
+	if count != 9000 {
+		t.Errorf("Expected 9000 entries from the later logs but found %d", count)
+	}
+}
+
+func TestOrderUnderRaces(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		const logCount, entryCount = 8, 200
+
+		logs := make(chan (chan string))
+		orderedLog := OrderedLogDrainer(logs)
+
+		go func() {
+			for i := 1; i <= logCount; i++ {
+				log := make(chan string)
+				logs <- log
+
+				go func(i int) {
+					for j := 0; j < entryCount; j++ {
+						if rand.Intn(10) == 0 {
+							runtime.Gosched()
+						}
+
+						log <- fmt.Sprintf("%d-%d", i, j)
+					}
+
+					close(log)
+				}(i)
+			}
+
+			close(logs)
+		}()
+
+		var expected []string
+
+		for i := 1; i <= logCount; i++ {
+			for j := 0; j < entryCount; j++ {
+				expected = append(expected, fmt.Sprintf("%d\t%d-%d", i, i, j))
+			}
+		}
+
+		testDrained(t, expected, orderedLog)
+	}
+}
+
+func TestNoLogs(t *testing.T) {
+	logs := make(chan (chan string))
+	orderedLog := OrderedLogDrainer(logs)
+	close(logs)
+
+	testDrained(t, nil, orderedLog)
+}
+
+func testDrained(t *testing.T, expected []string, orderedLog chan string) {
+	var found []string
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case logEntry, isOpen := <-orderedLog:
+			if !isOpen {
+				if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+					t.Errorf("Expected\n---\n%s\n---\nbut found\n---\n%s\n---\n", strings.Join(expected, "\n"), strings.Join(found, "\n"))
+				}
+
+				return
+			}
+
+			found = append(found, logEntry)
+		case <-timeout:
+			t.Fatalf("Timed out after %d entries", len(found))
+		}
+	}
+}
+
+func TestOutputClosesOnlyAfterEveryLogIsDrained(t *testing.T) {
+	logs := make(chan (chan string))
+	orderedLog := OrderedLogDrainer(logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+	logs <- nil
+	close(logs)
+
+	second <- "late in second"
+	close(second)
+
+	select {
+	case logEntry, isOpen := <-orderedLog:
+		t.Fatalf("Expected nothing while the first log is open but found %q (open: %v)", logEntry, isOpen)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	first <- "late in first"
+	close(first)
+
+	testDrained(t, []string{"1\tlate in first", "2\tlate in second"}, orderedLog)
+}
+
+func TestNoGoroutinesLeakAfterDraining(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for round := 0; round < 10; round++ {
+		logs := make(chan (chan string))
+		orderedLog := OrderedLogDrainer(logs)
+
+		for i := 0; i < 20; i++ {
+			log := make(chan string)
+			logs <- log
+
+			go func() {
+				log <- "entry"
+				close(log)
+			}()
+		}
+
+		close(logs)
+
+		for range orderedLog {
+		}
+	}
+
+	testNoLeaks(t, before)
+}
+
+func testNoLeaks(t *testing.T, before int) {
+	deadline := time.Now().Add(time.Second)
+
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buffer := make([]byte, 1<<16)
+			t.Fatalf("Expected %d goroutines but found %d:\n%s", before, runtime.NumGoroutine(), buffer[:runtime.Stack(buffer, true)])
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestContextCancellationClosesPromptly(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	logs := make(chan (chan string))
+	orderedLog, done := OrderedLogDrainerContext(ctx, logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+	first <- "before cancel"
+	second <- "buffered in second"
+
+	if logEntry := <-orderedLog; logEntry != "1\tbefore cancel" {
+		t.Errorf("Expected the entry written before cancelling but found %q", logEntry)
+	}
+
+	cancel()
+
+	select {
+	case <-testClosed(orderedLog):
+	case <-time.After(time.Second):
+		t.Fatal("Expected the output to be closed after cancelling")
+	}
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the drain to be reported as cancelled but found %v", err)
+	}
+
+	testNoLeaks(t, before)
+}
+
+func TestContextCompletedDrain(t *testing.T) {
+	logs := make(chan (chan string))
+	orderedLog, done := OrderedLogDrainerContext(context.Background(), logs)
+
+	log := make(chan string)
+	logs <- log
+	close(logs)
+	log <- "only entry"
+	close(log)
+
+	testDrained(t, []string{"1\tonly entry"}, orderedLog)
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected the drain to complete but found %v", err)
+	}
+}
+
+func testClosed(orderedLog chan string) chan struct{} {
+	closed := make(chan struct{})
+
+	go func() {
+		for range orderedLog {
+		}
+
+		close(closed)
+	}()
+
+	return closed
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Лог, регистриран с име и етикети (например host, service, pod).
+type Source[T any] struct {
+	Name    string
+	Labels  map[string]string
+	Entries chan T
+	// Ако Entries е nil, логът се отваря с Reopen, като се пропускат
+	// вече обработените според Drainer.Checkpoint записи. Каналът трябва
+	// да спре да се пише при прекратяване на ctx, а fail прекратява
+	// изпразването с грешка, възникнала след отварянето.
+	Reopen func(ctx context.Context, offset int, fail func(error)) (chan T, error)
+	// Ако не е нула, замества Drainer.IdleTimeout за този източник.
+	// Отрицателна стойност означава, че източникът никога не застива.
+	IdleTimeout time.Duration
+}
+
+// Времето без записи, след което източникът е застинал: собственото му,
+// ако е зададено, иначе това на Drainer.
+func (s *Source[T]) idleTimeout(fallback time.Duration) time.Duration {
+	if s.IdleTimeout != 0 {
+		return s.IdleTimeout
+	}
+
+	return fallback
+}
+
+// Копие на source, което носи поредния си номер за име, ако няма друго,
+// и е отворено с Reopen, ако трябва, заедно с отместването, от което
+// започват записите му.
+func (d *Drainer[T]) openSource(ctx context.Context, fail context.CancelCauseFunc, index int, source *Source[T]) (*Source[T], int, error) {
+	var named Source[T]
+
+	if source != nil {
+		named = *source
+	}
+
+	if named.Name == "" {
+		named.Name = strconv.Itoa(index)
+	}
+
+	offset := d.Checkpoint.Offset(named.Name)
+
+	if named.Entries == nil && named.Reopen != nil {
+		var err error
+
+		if named.Entries, err = named.Reopen(ctx, offset, fail); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return &named, offset, nil
+}
+
+// Пропуска нататък само записите, за които keep е вярно.
+// Спира при прекратяване на ctx, дори ако никой не чете изхода.
+func Filter[T any](ctx context.Context, entries <-chan Entry[T], keep func(Entry[T]) bool) <-chan Entry[T] {
+	kept := make(chan Entry[T], bufferSize)
+
+	go func() {
+		defer close(kept)
+
+		for entry := range entries {
+			if !keep(entry) {
+				continue
+			}
+
+			select {
+			case kept <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return kept
+}
+
+// Форматира записа с името и етикетите на източника му,
+// например "web{host=a,pod=web-1}\tзапис".
+func FormatSourceEntry[T any](entry Entry[T]) string {
+	keys := make([]string, 0, len(entry.Labels))
+
+	for key := range entry.Labels {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	labels := make([]string, len(keys))
+
+	for i, key := range keys {
+		labels[i] = key + "=" + entry.Labels[key]
+	}
+
+	name := entry.Name
+
+	if len(labels) > 0 {
+		name += "{" + strings.Join(labels, ",") + "}"
+	}
+
+	if entry.Marker != NoMarker {
+		return fmt.Sprintf("%s\t-- %s --", name, entry.Marker)
+	}
+
+	return fmt.Sprintf("%s\t%v", name, entry.Value)
+}
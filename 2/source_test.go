@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDrainSourcesCarriesNamesAndLabels(t *testing.T) {
+	ctx := context.Background()
+	sources := make(chan *Source[string])
+	entries, _ := (&Drainer[string]{}).DrainSources(ctx, sources)
+
+	web := &Source[string]{
+		Name:    "web",
+		Labels:  map[string]string{"host": "a", "pod": "web-1"},
+		Entries: make(chan string),
+	}
+	worker := &Source[string]{Entries: make(chan string)}
+	sources <- web
+	sources <- worker
+	close(sources)
+
+	worker.Entries <- "job done"
+	close(worker.Entries)
+	web.Entries <- "GET /"
+	close(web.Entries)
+
+	expected := []string{
+		"web{host=a,pod=web-1}\tGET /",
+		"2\tjob done",
+	}
+
+	testDrained(t, expected, Format(ctx, entries, FormatSourceEntry[string]))
+
+	if worker.Name != "" {
+		t.Errorf("Expected the registered source to be left unchanged but found name %q", worker.Name)
+	}
+}
+
+func TestFilterByLabels(t *testing.T) {
+	ctx := context.Background()
+	sources := make(chan *Source[string])
+	entries, _ := (&Drainer[string]{}).DrainSources(ctx, sources)
+	production := Filter(ctx, entries, func(entry Entry[string]) bool {
+		return entry.Labels["env"] == "production"
+	})
+
+	for _, env := range []string{"staging", "production", ""} {
+		source := &Source[string]{Name: "api", Entries: make(chan string, 1)}
+
+		if env != "" {
+			source.Labels = map[string]string{"env": env}
+		}
+
+		source.Entries <- "request in " + env
+		close(source.Entries)
+		sources <- source
+	}
+
+	close(sources)
+
+	testDrained(t, []string{"api{env=production}\trequest in production"}, Format(ctx, production, FormatSourceEntry[string]))
+}
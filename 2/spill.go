@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+const defaultSegmentSize = 4096
+
+// Общ лимит за записите, задържани в паметта от всички буфери на един Drain.
+type memoryBudget struct {
+	limit int64
+	held  atomic.Int64
+}
+
+func (b *memoryBudget) tryAcquire() bool {
+	if b.limit <= 0 {
+		return true
+	}
+
+	if b.held.Add(1) > b.limit {
+		b.held.Add(-1)
+		return false
+	}
+
+	return true
+}
+
+func (b *memoryBudget) release() {
+	if b.limit > 0 {
+		b.held.Add(-1)
+	}
+}
+
+type spillSegment[T any] struct {
+	path    string
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+	written int
+	reader  *os.File
+	decoder *gob.Decoder
+	read    int
+}
+
+// Опашка от записи във временни файлове (сегменти). Пише се в последния
+// сегмент, чете се от първия, а прочетените докрай сегменти се изтриват.
+type spillQueue[T any] struct {
+	dir         string
+	segmentSize int
+	segments    []*spillSegment[T]
+	length      int
+}
+
+func newSpillQueue[T any](dir string, segmentSize int) *spillQueue[T] {
+	if segmentSize <= 0 {
+		segmentSize = defaultSegmentSize
+	}
+
+	return &spillQueue[T]{dir: dir, segmentSize: segmentSize}
+}
+
+func (q *spillQueue[T]) Len() int {
+	return q.length
+}
+
+func (q *spillQueue[T]) Push(value T) error {
+	if len(q.segments) == 0 || q.segments[len(q.segments)-1].written >= q.segmentSize {
+		file, err := os.CreateTemp(q.dir, "drain-*.spill")
+
+		if err != nil {
+			return err
+		}
+
+		writer := bufio.NewWriter(file)
+		q.segments = append(q.segments, &spillSegment[T]{
+			path:    file.Name(),
+			file:    file,
+			writer:  writer,
+			encoder: gob.NewEncoder(writer),
+		})
+	}
+
+	segment := q.segments[len(q.segments)-1]
+
+	if err := segment.encoder.Encode(&value); err != nil {
+		return err
+	}
+
+	segment.written++
+	q.length++
+	return nil
+}
+
+func (q *spillQueue[T]) Pop() (value T, err error) {
+	segment := q.segments[0]
+
+	if segment.reader == nil {
+		if segment.reader, err = os.Open(segment.path); err != nil {
+			return
+		}
+
+		segment.decoder = gob.NewDecoder(bufio.NewReader(segment.reader))
+	}
+
+	// Последният сегмент още се пише, затова буферът му трябва да
+	// стигне до файла, преди да четем от него.
+	if err = segment.writer.Flush(); err != nil {
+		return
+	}
+
+	if err = segment.decoder.Decode(&value); err != nil {
+		return
+	}
+
+	segment.read++
+	q.length--
+
+	if segment.read == segment.written && (segment.written >= q.segmentSize || q.length == 0) {
+		q.segments = q.segments[1:]
+		err = segment.remove()
+	}
+
+	return
+}
+
+// Изтрива всички сегменти, включително непрочетените.
+func (q *spillQueue[T]) Close() error {
+	var errs []error
+
+	for _, segment := range q.segments {
+		errs = append(errs, segment.remove())
+	}
+
+	q.segments = nil
+	q.length = 0
+	return errors.Join(errs...)
+}
+
+func (s *spillSegment[T]) remove() error {
+	err := s.file.Close()
+
+	if s.reader != nil {
+		err = errors.Join(err, s.reader.Close())
+	}
+
+	return errors.Join(err, os.Remove(s.path))
+}
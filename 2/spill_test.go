@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpillQueue(t *testing.T) {
+	dir := t.TempDir()
+	queue := newSpillQueue[testEvent](dir, 3)
+
+	for i := 0; i < 5; i++ {
+		if err := queue.Push(testEvent{"info", fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 7; i++ {
+		value, err := queue.Pop()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value.Message != fmt.Sprint(i) {
+			t.Errorf("Expected message %d but found %q", i, value.Message)
+		}
+
+		// Пишем и докато четем, включително в сегмента, от който се чете.
+		if i == 1 || i == 3 {
+			queue.Push(testEvent{"info", fmt.Sprint(i/2 + 5)})
+		}
+	}
+
+	if queue.Len() != 0 {
+		t.Errorf("Expected an empty queue but found %d entries", queue.Len())
+	}
+
+	testDirEntries(t, dir, 0)
+}
+
+func TestDrainSpillsLaterLogsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	drainer := &Drainer[string]{MemoryBudget: 10, SpillDir: dir, SegmentSize: 100}
+	logs := make(chan (chan string))
+	entries, done := drainer.Drain(context.Background(), logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+	close(logs)
+
+	for i := 0; i < 1000; i++ {
+		second <- fmt.Sprint(i)
+	}
+
+	close(second)
+
+	if count := testDirEntries(t, dir, -1); count < 9 {
+		t.Errorf("Expected the held back entries to be spilled to at least 9 segments but found %d", count)
+	}
+
+	first <- "first"
+	close(first)
+
+	var expected []string
+
+	expected = append(expected, "1\tfirst")
+
+	for i := 0; i < 1000; i++ {
+		expected = append(expected, fmt.Sprintf("2\t%d", i))
+	}
+
+	testDrained(t, expected, Format(context.Background(), entries, FormatLogEntry))
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected the drain to complete but found %v", err)
+	}
+
+	testDirEntries(t, dir, 0)
+}
+
+func TestDrainReportsSpillErrors(t *testing.T) {
+	drainer := &Drainer[string]{MemoryBudget: 1, SpillDir: "/nonexistent/spill/dir"}
+	logs := make(chan (chan string))
+	entries, done := drainer.Drain(context.Background(), logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+	second <- "next to be sent"
+	second <- "held in memory"
+	second <- "cannot be spilled"
+
+	select {
+	case err := <-done:
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected the spill error but found %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the drain to fail")
+	}
+
+	for range entries {
+	}
+}
+
+func testDirEntries(t *testing.T, dir string, expected int) int {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected >= 0 && len(entries) != expected {
+		t.Errorf("Expected %d files in %s but found %d", expected, dir, len(entries))
+	}
+
+	return len(entries)
+}
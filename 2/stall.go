@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Какво се прави с източник, застинал по-дълго от Drainer.IdleTimeout.
+type StallPolicy int
+
+const (
+	// Източникът отива в края на опашката и записите му продължават,
+	// когато му дойде редът отново. В изхода се появява SkipMarker.
+	StallSkip StallPolicy = iota
+	// Източникът запазва мястото си, но вече буферираните записи на
+	// следващите източници излизат веднага след GapMarker.
+	StallGap
+	// Изпразването спира със *StallError.
+	StallFail
+)
+
+// Вид на служебен запис в изхода.
+type Marker int
+
+const (
+	NoMarker Marker = iota
+	SkipMarker
+	GapMarker
+)
+
+func (m Marker) String() string {
+	switch m {
+	case SkipMarker:
+		return "stalled, skipped for now"
+	case GapMarker:
+		return "stalled, gap follows"
+	}
+
+	return ""
+}
+
+type StallError struct {
+	Source int
+	Name   string
+	Idle   time.Duration
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("source %s stalled for %s", e.Name, e.Idle)
+}
+
+type gapRead[T any] struct {
+	log   *registeredLog[T]
+	count int
+}
+
+// Обработва застиналия първи източник в queue според d.Stall. Връща
+// новата опашка, новите готови за изпращане записи и съседите, от които
+// да се прочетат вече получените записи след GapMarker. Служебен запис
+// се добавя само ако решението води до някакъв напредък.
+func (d *Drainer[T]) stall(stats *drainStats, queue []*registeredLog[T], ready []Entry[T]) ([]*registeredLog[T], []Entry[T], []gapRead[T], error) {
+	stalled := queue[0]
+
+	if d.Stall == StallFail {
+		return queue, ready, nil, &StallError{stalled.index, stalled.source.Name, stalled.source.idleTimeout(d.IdleTimeout)}
+	}
+
+	var (
+		gaps      []gapRead[T]
+		hasClosed bool
+	)
+
+	for _, neighbour := range queue[1:] {
+		received, isOpen := stats.state(neighbour.index)
+
+		if count := received - neighbour.read; count > 0 {
+			gaps = append(gaps, gapRead[T]{neighbour, count})
+		} else if !isOpen {
+			hasClosed = true
+		}
+	}
+
+	marker := Entry[T]{Source: stalled.index, Name: stalled.source.Name, Labels: stalled.source.Labels}
+
+	if d.Stall == StallSkip {
+		// Завъртането има смисъл, само ако след него някой от съседите
+		// може да продължи - с буферирани записи или като приключи.
+		if len(gaps) > 0 || hasClosed {
+			marker.Marker = SkipMarker
+			ready = append(ready, marker)
+			queue = append(queue[1:], stalled)
+		}
+
+		return queue, ready, nil, nil
+	}
+
+	if len(gaps) > 0 {
+		marker.Marker = GapMarker
+		ready = append(ready, marker)
+	}
+
+	return queue, ready, gaps, nil
+}
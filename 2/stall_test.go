@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStallSkipComesBackToTheStalledLog(t *testing.T) {
+	logs := make(chan (chan string))
+	d := &Drainer[string]{IdleTimeout: 20 * time.Millisecond, Stall: StallSkip}
+	orderedLog, _ := OrderedLogDrainerWith(context.Background(), d, logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+	second <- "a"
+	second <- "b"
+	close(second)
+
+	for _, expected := range []string{"1\t-- stalled, skipped for now --", "2\ta", "2\tb"} {
+		if logEntry := <-orderedLog; logEntry != expected {
+			t.Fatalf("Expected %q but found %q", expected, logEntry)
+		}
+	}
+
+	first <- "finally"
+	close(first)
+	close(logs)
+
+	testDrained(t, []string{"1\tfinally"}, orderedLog)
+}
+
+func TestStallGapEmitsBufferedNeighbours(t *testing.T) {
+	logs := make(chan (chan string))
+	d := &Drainer[string]{IdleTimeout: 20 * time.Millisecond, Stall: StallGap}
+	orderedLog, _ := OrderedLogDrainerWith(context.Background(), d, logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	third := make(chan string)
+	logs <- first
+	logs <- second
+	logs <- third
+	second <- "a"
+	third <- "b"
+	close(third)
+
+	for _, expected := range []string{"1\t-- stalled, gap follows --", "2\ta", "3\tb"} {
+		if logEntry := <-orderedLog; logEntry != expected {
+			t.Fatalf("Expected %q but found %q", expected, logEntry)
+		}
+	}
+
+	first <- "finally"
+	close(first)
+	second <- "c"
+	close(second)
+	close(logs)
+
+	testDrained(t, []string{"1\tfinally", "2\tc"}, orderedLog)
+}
+
+func TestStallFailEndsTheDrain(t *testing.T) {
+	logs := make(chan (chan string))
+	d := &Drainer[string]{IdleTimeout: 20 * time.Millisecond, Stall: StallFail}
+	orderedLog, done := OrderedLogDrainerWith(context.Background(), d, logs)
+
+	logs <- make(chan string)
+
+	select {
+	case <-testClosed(orderedLog):
+	case <-time.After(time.Second):
+		t.Fatal("Expected the output to be closed after the log stalled")
+	}
+
+	var stallErr *StallError
+
+	if err := <-done; !errors.As(err, &stallErr) || stallErr.Source != 1 {
+		t.Errorf("Expected the first log to be reported as stalled but found %v", err)
+	}
+}
+
+func TestNoStallWhileEntriesKeepComing(t *testing.T) {
+	logs := make(chan (chan string))
+	d := &Drainer[string]{IdleTimeout: 30 * time.Millisecond, Stall: StallFail}
+	orderedLog, done := OrderedLogDrainerWith(context.Background(), d, logs)
+
+	log := make(chan string)
+	logs <- log
+	close(logs)
+
+	var expected []string
+
+	for i := 0; i < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		log <- "tick"
+		expected = append(expected, "1\ttick")
+	}
+
+	close(log)
+	testDrained(t, expected, orderedLog)
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected the drain to complete but found %v", err)
+	}
+}
+
+func TestStallSkipIsQuietWhenNothingCanProgress(t *testing.T) {
+	logs := make(chan (chan string))
+	d := &Drainer[string]{IdleTimeout: 5 * time.Millisecond, Stall: StallSkip}
+	orderedLog, _ := OrderedLogDrainerWith(context.Background(), d, logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+
+	select {
+	case logEntry := <-orderedLog:
+		t.Fatalf("Expected no skip markers while every log is silent but found %q", logEntry)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	second <- "b"
+
+	if logEntry := <-orderedLog; logEntry != "1\t-- stalled, skipped for now --" {
+		t.Fatalf("Expected a single skip marker once the second log has entries but found %q", logEntry)
+	}
+
+	if logEntry := <-orderedLog; logEntry != "2\tb" {
+		t.Fatalf("Expected the entry of the second log but found %q", logEntry)
+	}
+
+	close(first)
+	close(second)
+	close(logs)
+
+	testDrained(t, nil, orderedLog)
+}
+
+func TestStallGapReadsSpilledNeighboursOneAtATime(t *testing.T) {
+	dir := t.TempDir()
+	logs := make(chan (chan string))
+	d := &Drainer[string]{IdleTimeout: 50 * time.Millisecond, Stall: StallGap, MemoryBudget: 2, SpillDir: dir, SegmentSize: 4}
+	orderedLog, _ := OrderedLogDrainerWith(context.Background(), d, logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+
+	var expected []string
+
+	for i := 0; i < 20; i++ {
+		second <- fmt.Sprint(i)
+		expected = append(expected, fmt.Sprintf("2\t%d", i))
+	}
+
+	if logEntry := <-orderedLog; logEntry != "1\t-- stalled, gap follows --" {
+		t.Fatalf("Expected a gap marker but found %q", logEntry)
+	}
+
+	for _, expected := range expected {
+		if logEntry := <-orderedLog; logEntry != expected {
+			t.Fatalf("Expected %q but found %q", expected, logEntry)
+		}
+	}
+
+	testDirEntries(t, dir, 0)
+	close(first)
+	close(second)
+	close(logs)
+
+	testDrained(t, nil, orderedLog)
+}
+
+func TestSourceIdleTimeoutOverridesDrainer(t *testing.T) {
+	sources := make(chan *Source[string])
+	d := &Drainer[string]{IdleTimeout: time.Hour, Stall: StallFail}
+	entries, done := d.DrainSources(context.Background(), sources)
+
+	sources <- &Source[string]{Name: "quick", Entries: make(chan string), IdleTimeout: 10 * time.Millisecond}
+
+	for range entries {
+	}
+
+	var stallErr *StallError
+
+	if err := <-done; !errors.As(err, &stallErr) || stallErr.Name != "quick" || stallErr.Idle != 10*time.Millisecond {
+		t.Errorf("Expected the source's own timeout to apply but found %v", err)
+	}
+}
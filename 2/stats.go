@@ -0,0 +1,137 @@
+package main
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Състоянието на един източник в текущото изпразване.
+type SourceStats struct {
+	Source    int               `json:"source"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Received  int               `json:"received"`
+	Emitted   int               `json:"emitted"`
+	Dropped   int               `json:"dropped"`
+	Bytes     int64             `json:"bytes"`
+	Buffered  int               `json:"buffered"`
+	LastEntry time.Time         `json:"last_entry"`
+	// Колко време е минало от последния запис (или от регистрацията,
+	// ако още няма записи) до момента на Stats.
+	Idle time.Duration `json:"idle"`
+	Open bool          `json:"open"`
+}
+
+type drainStats struct {
+	mutex   sync.Mutex
+	sources map[int]*SourceStats
+	since   map[int]time.Time
+}
+
+func newDrainStats() *drainStats {
+	return &drainStats{sources: map[int]*SourceStats{}, since: map[int]time.Time{}}
+}
+
+func (s *drainStats) add(index int, name string, labels map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sources[index] = &SourceStats{Source: index, Name: name, Labels: labels, Open: true}
+	s.since[index] = time.Now()
+}
+
+func (s *drainStats) receive(index int, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	source := s.sources[index]
+	source.Received++
+	source.Bytes += int64(size)
+	source.LastEntry = time.Now()
+	s.since[index] = source.LastEntry
+}
+
+// Колко записа са получени от източника и дали още е отворен.
+func (s *drainStats) state(index int) (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	source := s.sources[index]
+	return source.Received, source.Open
+}
+
+func (s *drainStats) emit(index int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sources[index].Emitted++
+}
+
+func (s *drainStats) drop(index int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sources[index].Dropped++
+}
+
+func (s *drainStats) close(index int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sources[index].Open = false
+}
+
+func (s *drainStats) snapshot() []SourceStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	snapshot := make([]SourceStats, 0, len(s.sources))
+
+	for index, source := range s.sources {
+		stats := *source
+		stats.Buffered = stats.Received - stats.Emitted - stats.Dropped
+		stats.Idle = now.Sub(s.since[index])
+		snapshot = append(snapshot, stats)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Source < snapshot[j].Source })
+	return snapshot
+}
+
+// Размерът на записа в байтове за статистиката: d.Size, ако е зададен,
+// иначе дължината на низове и []byte и нула за всичко останало.
+func (d *Drainer[T]) entrySize(value T) int {
+	if d.Size != nil {
+		return d.Size(value)
+	}
+
+	switch value := any(value).(type) {
+	case string:
+		return len(value)
+	case []byte:
+		return len(value)
+	}
+
+	return 0
+}
+
+// Състоянието на всеки източник в последното изпразване, започнато с d,
+// подредено по поредния номер на източника. Преди първото изпразване е nil.
+func (d *Drainer[T]) Stats() []SourceStats {
+	stats := d.stats.Load()
+
+	if stats == nil {
+		return nil
+	}
+
+	return stats.snapshot()
+}
+
+// Публикува Stats в expvar под името name (например за /debug/vars).
+// Като expvar.Publish, изпада в паника, ако името вече е заето.
+func (d *Drainer[T]) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return d.Stats() }))
+}
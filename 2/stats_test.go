@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Изчаква статистиката да стигне до expected, като пренебрегва
+// LastEntry и Idle, които зависят от времето.
+func testStats(t *testing.T, d *Drainer[string], expected []SourceStats) []SourceStats {
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		found := d.Stats()
+		comparable := make([]SourceStats, len(found))
+
+		for i, stats := range found {
+			stats.LastEntry, stats.Idle = time.Time{}, 0
+			comparable[i] = stats
+		}
+
+		if reflect.DeepEqual(comparable, expected) {
+			return found
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected stats %+v but found %+v", expected, comparable)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStatsTracksEachSource(t *testing.T) {
+	d := &Drainer[string]{}
+
+	if stats := d.Stats(); stats != nil {
+		t.Errorf("Expected no stats before draining but found %+v", stats)
+	}
+
+	logs := make(chan (chan string))
+	entries, _ := d.Drain(context.Background(), logs)
+
+	first := make(chan string)
+	second := make(chan string)
+	logs <- first
+	logs <- second
+
+	first <- "abc"
+	first <- "de"
+	second <- "waiting"
+	close(second)
+
+	<-entries
+	<-entries
+
+	found := testStats(t, d, []SourceStats{
+		{Source: 1, Name: "1", Received: 2, Emitted: 2, Bytes: 5, Open: true},
+		{Source: 2, Name: "2", Received: 1, Bytes: 7, Buffered: 1},
+	})
+
+	if found[0].LastEntry.IsZero() || found[0].Idle <= 0 {
+		t.Errorf("Expected the time of the last entry to be tracked but found %+v", found[0])
+	}
+
+	close(first)
+	close(logs)
+
+	for range entries {
+	}
+
+	testStats(t, d, []SourceStats{
+		{Source: 1, Name: "1", Received: 2, Emitted: 2, Bytes: 5},
+		{Source: 2, Name: "2", Received: 1, Emitted: 1, Bytes: 7},
+	})
+}
+
+func TestStatsCountDroppedLateEntries(t *testing.T) {
+	d := &Drainer[string]{Timestamp: testTimestamp, Late: LateDrop}
+	logs := make(chan (chan string))
+	entries, _ := d.Drain(context.Background(), logs)
+
+	log := make(chan string)
+	logs <- log
+	close(logs)
+	log <- "2 on time"
+	<-entries
+	log <- "1 late"
+	close(log)
+
+	for range entries {
+	}
+
+	testStats(t, d, []SourceStats{
+		{Source: 1, Name: "1", Received: 2, Emitted: 1, Dropped: 1, Bytes: 15},
+	})
+}
+
+func TestStatsArePublishedThroughExpvar(t *testing.T) {
+	d := &Drainer[string]{}
+	name := fmt.Sprintf("test-drain-%p", d)
+	d.Publish(name)
+
+	logs := make(chan (chan string))
+	entries, _ := d.Drain(context.Background(), logs)
+	logs <- nil
+	close(logs)
+
+	for range entries {
+	}
+
+	var published []SourceStats
+
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(published) != 1 || published[0].Name != "1" || published[0].Open {
+		t.Errorf("Expected one closed source in expvar but found %+v", published)
+	}
+}
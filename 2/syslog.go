@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Най-много толкова цифри има броят октети пред рамка по TCP.
+const maxOctetCountDigits = 6
+
+// Разпознато syslog съобщение (RFC 5424 или RFC 3164). Липсващите
+// полета ("-" в RFC 5424) са празни.
+type SyslogMessage struct {
+	Facility int
+	Severity int
+	Time     time.Time
+	Hostname string
+	AppName  string
+	ProcID   string
+	MsgID    string
+	// Структурираните данни на RFC 5424 по SD-ID и име на параметър.
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+func (m *SyslogMessage) String() string {
+	tag := m.AppName
+
+	if m.ProcID != "" {
+		tag += "[" + m.ProcID + "]"
+	}
+
+	return fmt.Sprintf("%s %s %s: %s", m.Time.Format(time.RFC3339), m.Hostname, tag, m.Message)
+}
+
+type MalformedSyslogError struct {
+	Message string
+}
+
+func (e *MalformedSyslogError) Error() string {
+	return fmt.Sprintf("malformed syslog message %q", e.Message)
+}
+
+// Разпознава едно syslog съобщение. RFC 3164 няма година, затова се
+// взима текущата.
+func ParseSyslog(line string) (*SyslogMessage, error) {
+	end := strings.IndexByte(line, '>')
+
+	if !strings.HasPrefix(line, "<") || end < 2 || end > 4 {
+		return nil, &MalformedSyslogError{line}
+	}
+
+	for _, digit := range line[1:end] {
+		if digit < '0' || digit > '9' {
+			return nil, &MalformedSyslogError{line}
+		}
+	}
+
+	priority, err := strconv.Atoi(line[1:end])
+
+	if err != nil || priority > 191 {
+		return nil, &MalformedSyslogError{line}
+	}
+
+	message := &SyslogMessage{Facility: priority / 8, Severity: priority % 8}
+	rest := line[end+1:]
+
+	if strings.HasPrefix(rest, "1 ") {
+		if err := parseSyslog5424(message, rest[2:]); err != nil {
+			return nil, &MalformedSyslogError{line}
+		}
+
+		return message, nil
+	}
+
+	parseSyslog3164(message, rest)
+	return message, nil
+}
+
+func syslogField(field string) string {
+	if field == "-" {
+		return ""
+	}
+
+	return field
+}
+
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseSyslog5424(message *SyslogMessage, rest string) error {
+	fields := strings.SplitN(rest, " ", 6)
+
+	if len(fields) < 6 {
+		return errors.New("missing header fields")
+	}
+
+	if fields[0] != "-" {
+		var err error
+
+		if message.Time, err = time.Parse(time.RFC3339Nano, fields[0]); err != nil {
+			return err
+		}
+	}
+
+	message.Hostname = syslogField(fields[1])
+	message.AppName = syslogField(fields[2])
+	message.ProcID = syslogField(fields[3])
+	message.MsgID = syslogField(fields[4])
+
+	data, text, err := parseStructuredData(fields[5])
+
+	if err != nil {
+		return err
+	}
+
+	message.StructuredData = data
+	message.Message = strings.TrimPrefix(text, "\ufeff")
+	return nil
+}
+
+// Разбира "-" или поредица от [SD-ID име="стойност" ...] и връща
+// останалото след тях.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	if s == "-" || strings.HasPrefix(s, "- ") {
+		return nil, strings.TrimPrefix(s[1:], " "), nil
+	}
+
+	data := map[string]map[string]string{}
+
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+
+		if end < 0 {
+			return nil, "", errors.New("unterminated structured data")
+		}
+
+		params := map[string]string{}
+		data[s[1:end]] = params
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			eq := strings.Index(s, `="`)
+
+			if eq < 0 {
+				return nil, "", errors.New("malformed structured data parameter")
+			}
+
+			name := s[1:eq]
+			value, size, err := parseParamValue(s[eq+2:])
+
+			if err != nil {
+				return nil, "", err
+			}
+
+			params[name] = value
+			s = s[eq+2+size:]
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", errors.New("unterminated structured data")
+		}
+
+		s = s[1:]
+	}
+
+	if len(data) == 0 {
+		return nil, "", errors.New("missing structured data")
+	}
+
+	return data, strings.TrimPrefix(s, " "), nil
+}
+
+// Чете стойност до незаекранираната кавичка и връща колко байта е
+// прочел заедно с нея. В стойността \", \\ и \] са заекранирани.
+func parseParamValue(s string) (string, int, error) {
+	var value strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+				i++
+			}
+		case '"':
+			return value.String(), i + 1, nil
+		}
+
+		value.WriteByte(s[i])
+	}
+
+	return "", 0, errors.New("unterminated structured data value")
+}
+
+// Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG. Ако заглавната част не може да
+// се разпознае, целият текст е съобщението.
+func parseSyslog3164(message *SyslogMessage, rest string) {
+	message.Message = rest
+
+	if len(rest) < len(time.Stamp)+1 {
+		return
+	}
+
+	stamp, err := time.ParseInLocation(time.Stamp, rest[:len(time.Stamp)], time.Local)
+
+	if err != nil || rest[len(time.Stamp)] != ' ' {
+		return
+	}
+
+	message.Time = stamp.AddDate(time.Now().Year(), 0, 0)
+	rest = rest[len(time.Stamp)+1:]
+	message.Hostname, rest, _ = strings.Cut(rest, " ")
+	message.Message = rest
+
+	end := strings.IndexAny(rest, "[: ")
+
+	if end <= 0 || rest[end] == ' ' {
+		return
+	}
+
+	tag, after := rest[:end], rest[end:]
+
+	if after[0] == '[' {
+		pid, afterPid, found := strings.Cut(after[1:], "]")
+
+		if !found {
+			return
+		}
+
+		message.ProcID, after = pid, afterPid
+	}
+
+	if !strings.HasPrefix(after, ":") {
+		message.ProcID = ""
+		return
+	}
+
+	message.AppName = tag
+	message.Message = strings.TrimPrefix(after[1:], " ")
+}
+
+// Приема syslog съобщения по UDP (по едно в пакет) и по TCP с рамкиране
+// по RFC 6587: "брой-октети SP съобщение" или съобщение, завършващо с LF.
+// Съобщенията се групират в източници по hostname/app-name, регистрирани
+// в реда на първото си съобщение, с етикети hostname и app_name.
+type SyslogReceiver struct {
+	// Извиква се за всяко неразпознато съобщение, възможно едновременно
+	// от няколко горутини. Ако е nil, неразпознатите съобщения се пропускат.
+	Malformed func(error)
+}
+
+// Приема съобщения от packets и/или listener (всеки от тях може да е nil).
+// Всички източници се затварят, когато и двата входа бъдат затворени
+// (и приетите TCP връзки - също) или ctx бъде прекратен. Тъй като
+// източниците са отворени дотогава, при сливане по реда на логовете
+// трябва Drainer.IdleTimeout, за да не чакат всички първия.
+// След края по втория канал идват грешките от входовете, ако има такива.
+func (r *SyslogReceiver) Receive(ctx context.Context, packets net.PacketConn, listener net.Listener) (chan *Source[*SyslogMessage], <-chan error) {
+	messages := make(chan *SyslogMessage)
+	done := make(chan error, 1)
+	errs := make([]error, 2)
+
+	var wait sync.WaitGroup
+
+	if packets != nil {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+			errs[0] = r.readPackets(ctx, packets, messages)
+		}()
+	}
+
+	if listener != nil {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+			errs[1] = r.readConnections(ctx, listener, messages)
+		}()
+	}
+
+	go func() {
+		defer close(done)
+
+		wait.Wait()
+		close(messages)
+		done <- errors.Join(errs...)
+	}()
+
+	return groupSyslog(ctx, messages), done
+}
+
+func (r *SyslogReceiver) parse(line string) (*SyslogMessage, bool) {
+	message, err := ParseSyslog(line)
+
+	if err != nil {
+		if r.Malformed != nil {
+			r.Malformed(err)
+		}
+
+		return nil, false
+	}
+
+	return message, true
+}
+
+func (r *SyslogReceiver) readPackets(ctx context.Context, packets net.PacketConn, messages chan<- *SyslogMessage) error {
+	stop := context.AfterFunc(ctx, func() { packets.Close() })
+	defer stop()
+
+	buffer := make([]byte, 64*1024)
+
+	for {
+		size, _, err := packets.ReadFrom(buffer)
+
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			return err
+		}
+
+		message, ok := r.parse(strings.TrimRight(string(buffer[:size]), "\r\n"))
+
+		if !ok {
+			continue
+		}
+
+		select {
+		case messages <- message:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *SyslogReceiver) readConnections(ctx context.Context, listener net.Listener, messages chan<- *SyslogMessage) error {
+	sources, accepted := listenSources(ctx, listener, scanSyslogFrames)
+
+	var wait sync.WaitGroup
+
+	for source := range sources {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for line := range source.Entries {
+				message, ok := r.parse(line)
+
+				if !ok {
+					continue
+				}
+
+				select {
+				case messages <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	wait.Wait()
+
+	if err := <-accepted; err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+// bufio.SplitFunc за syslog по TCP (RFC 6587). Рамка, започваща с
+// цифра, е "брой-октети SP съобщение" и съобщението е точно толкова байта;
+// иначе съобщението стига до LF. Празните редове между рамките се пропускат.
+func scanSyslogFrames(data []byte, atEOF bool) (int, []byte, error) {
+	// Празните редове се пропускат в същото извикване: след EOF
+	// bufio.Scanner спира при напредък без запис.
+	skipped := len(data) - len(bytes.TrimLeft(data, "\r\n"))
+
+	if skipped == len(data) {
+		return skipped, nil, nil
+	}
+
+	advance, token, err := scanSyslogFrame(data[skipped:], atEOF)
+
+	if advance == 0 && token == nil {
+		return 0, nil, err
+	}
+
+	return skipped + advance, token, err
+}
+
+func scanSyslogFrame(data []byte, atEOF bool) (int, []byte, error) {
+	if data[0] < '0' || data[0] > '9' {
+		return bufio.ScanLines(data, atEOF)
+	}
+
+	space := bytes.IndexByte(data, ' ')
+
+	if space < 0 {
+		if atEOF || len(data) > maxOctetCountDigits {
+			return 0, nil, &MalformedSyslogError{string(data)}
+		}
+
+		return 0, nil, nil
+	}
+
+	count, err := strconv.Atoi(string(data[:space]))
+
+	if err != nil || space > maxOctetCountDigits || count > bufio.MaxScanTokenSize {
+		return 0, nil, &MalformedSyslogError{string(data[:space])}
+	}
+
+	end := space + 1 + count
+
+	if len(data) < end {
+		if atEOF {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+
+		return 0, nil, nil
+	}
+
+	return end, data[space+1 : end], nil
+}
+
+// Разпределя съобщенията по източници според hostname/app-name.
+func groupSyslog(ctx context.Context, messages <-chan *SyslogMessage) chan *Source[*SyslogMessage] {
+	sources := make(chan *Source[*SyslogMessage])
+
+	go func() {
+		defer close(sources)
+
+		groups := map[string]*Source[*SyslogMessage]{}
+
+		defer func() {
+			for _, source := range groups {
+				close(source.Entries)
+			}
+		}()
+
+		for message := range messages {
+			hostname, appName := message.Hostname, message.AppName
+			key := cmp.Or(hostname, "-") + "/" + cmp.Or(appName, "-")
+			source, ok := groups[key]
+
+			if !ok {
+				source = &Source[*SyslogMessage]{
+					Name:    key,
+					Labels:  map[string]string{"hostname": hostname, "app_name": appName},
+					Entries: make(chan *SyslogMessage),
+				}
+				groups[key] = source
+
+				select {
+				case sources <- source:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case source.Entries <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return sources
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	year := time.Now().Year()
+	cases := []struct {
+		line     string
+		expected SyslogMessage
+	}{
+		{
+			"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - \ufeff'su root' failed for lonvick on /dev/pts/8",
+			SyslogMessage{
+				Facility: 4, Severity: 2,
+				Time:     time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname: "mymachine.example.com", AppName: "su", MsgID: "ID47",
+				Message: "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			`<165>1 2003-10-11T22:14:15Z host evntslog 42 ID47 [exampleSDID@32473 iut="3" eventSource="Appl\"ication\]"][examplePriority@32473 class="high"] An application event`,
+			SyslogMessage{
+				Facility: 20, Severity: 5,
+				Time:     time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC),
+				Hostname: "host", AppName: "evntslog", ProcID: "42", MsgID: "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473":     {"iut": "3", "eventSource": `Appl"ication]`},
+					"examplePriority@32473": {"class": "high"},
+				},
+				Message: "An application event",
+			},
+		},
+		{
+			"<13>1 - - - - - -",
+			SyslogMessage{Facility: 1, Severity: 5},
+		},
+		{
+			"<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed",
+			SyslogMessage{
+				Facility: 4, Severity: 2,
+				Time:     time.Date(year, 10, 11, 22, 14, 15, 0, time.Local),
+				Hostname: "mymachine", AppName: "su", ProcID: "230",
+				Message: "'su root' failed",
+			},
+		},
+		{
+			"<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!",
+			SyslogMessage{
+				Facility: 1, Severity: 5,
+				Time:     time.Date(year, 2, 5, 17, 32, 18, 0, time.Local),
+				Hostname: "10.0.0.99",
+				Message:  "Use the BFG!",
+			},
+		},
+		{
+			"<13>no header at all",
+			SyslogMessage{Facility: 1, Severity: 5, Message: "no header at all"},
+		},
+	}
+
+	for _, test := range cases {
+		found, err := ParseSyslog(test.line)
+
+		if err != nil {
+			t.Errorf("Expected %q to be parsed but found %v", test.line, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(*found, test.expected) {
+			t.Errorf("Expected %q to be parsed as\n%+v\nbut found\n%+v", test.line, test.expected, *found)
+		}
+	}
+}
+
+func TestParseSyslogRejectsMalformed(t *testing.T) {
+	for _, line := range []string{
+		"no priority",
+		"<999>too high",
+		"<-1>1 - host app - - - negative",
+		"<+5>1 - host app - - - signed",
+		"<34>1 2003-10-11T22:14:15Z host app",
+		"<34>1 not-a-time host app - - - message",
+		`<34>1 - host app - - [id key="unterminated] message`,
+	} {
+		var malformed *MalformedSyslogError
+
+		if _, err := ParseSyslog(line); !errors.As(err, &malformed) {
+			t.Errorf("Expected %q to be rejected but found %v", line, err)
+		}
+	}
+}
+
+func TestSyslogReceiverOnLoopback(t *testing.T) {
+	packets, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var malformed []error
+	receiver := &SyslogReceiver{Malformed: func(err error) { malformed = append(malformed, err) }}
+	ctx := context.Background()
+	sources, received := receiver.Receive(ctx, packets, listener)
+	entries, done := (&Drainer[*SyslogMessage]{}).DrainSources(ctx, sources)
+	orderedLog := Format(ctx, entries, func(entry Entry[*SyslogMessage]) string {
+		return fmt.Sprintf("%d\t%s\t%s", entry.Source, entry.Name, entry.Value.Message)
+	})
+
+	udp, err := net.Dial("udp", packets.LocalAddr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer udp.Close()
+
+	fmt.Fprint(udp, "<14>1 2024-01-01T00:00:00Z web nginx - - - GET /\n")
+
+	if logEntry := <-orderedLog; logEntry != "1\tweb/nginx\tGET /" {
+		t.Fatalf("Expected the UDP message first but found %q", logEntry)
+	}
+
+	tcp, err := net.Dial("tcp", listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprint(tcp, "<11>Jan  1 00:00:01 db postgres[7]: checkpoint starting\n")
+	fmt.Fprint(tcp, "garbage\n")
+	fmt.Fprint(tcp, "49 <14>1 2024-01-01T00:00:02Z web nginx - - - GET /a")
+	fmt.Fprint(tcp, "25 <14>1 - web nginx - - - b25 <14>1 - web nginx - - - c\n")
+	fmt.Fprint(tcp, "<11>Jan  1 00:00:03 db postgres[7]: checkpoint complete\n")
+	tcp.Close()
+
+	for _, expected := range []string{"1\tweb/nginx\tGET /a", "1\tweb/nginx\tb", "1\tweb/nginx\tc"} {
+		if logEntry := <-orderedLog; logEntry != expected {
+			t.Fatalf("Expected %q from the octet-counted frames but found %q", expected, logEntry)
+		}
+	}
+
+	packets.Close()
+	listener.Close()
+
+	testDrained(t, []string{"2\tdb/postgres\tcheckpoint starting", "2\tdb/postgres\tcheckpoint complete"}, orderedLog)
+
+	if err := <-done; err != nil {
+		t.Errorf("Expected the drain to complete but found %v", err)
+	}
+
+	if err := <-received; err != nil {
+		t.Errorf("Expected the receiver to stop cleanly but found %v", err)
+	}
+
+	if len(malformed) != 1 {
+		t.Errorf("Expected one malformed message but found %v", malformed)
+	}
+}
+
+func TestScanSyslogFrames(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader("5 <1>ab\n<2>line\n\n3 <3>"))
+	scanner.Split(scanSyslogFrames)
+
+	var frames []string
+
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+
+	if fmt.Sprint(frames) != "[<1>ab <2>line <3>]" {
+		t.Errorf("Expected three frames but found %q", frames)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Errorf("Expected no error but found %v", err)
+	}
+
+	scanner = bufio.NewScanner(strings.NewReader("10 <1>short"))
+	scanner.Split(scanSyslogFrames)
+
+	for scanner.Scan() {
+		t.Errorf("Expected no frame from a truncated message but found %q", scanner.Text())
+	}
+
+	if err := scanner.Err(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected a truncated frame to be reported but found %v", err)
+	}
+}